@@ -0,0 +1,99 @@
+package discover
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// Annotate inserts a "// COVERED" or "// NOT COVERED" comment before each
+// statement in a statement list of f, and a trailing one on the first line
+// of each function declaration, according to the coverage profile. Unlike
+// Trim it leaves the code itself untouched, so the annotated file still
+// compiles and is easy to diff against the original.
+//
+// Case and comm clauses are annotated with a trailing comment after their
+// colon instead. Statements that do not start their line, such as a
+// statement following another on the same line, are not annotated.
+func (p *Profile) Annotate(f *ast.File) {
+	tf := p.Fset.File(f.Pos())
+	if tf == nil {
+		return
+	}
+	first := firstOnLine(tf, f)
+	cmap := ast.NewCommentMap(p.Fset, f, f.Comments)
+	if cmap == nil {
+		cmap = make(ast.CommentMap)
+	}
+	done := make(map[int]bool)
+
+	annotate := func(node ast.Node, covered bool) {
+		line := rawLine(tf, node.Pos())
+		if done[line] || first[line] != node.Pos() {
+			return
+		}
+		done[line] = true
+
+		at := tf.LineStart(line)
+		if colon := clauseColon(node); colon.IsValid() {
+			// A comment before a clause would print indented like, and
+			// read as part of, the body of the previous clause.
+			at = colon + 1
+		} else if at == node.Pos() {
+			return // no room before the statement
+		}
+		cmap[node] = append(cmap[node], coverageComment(at, covered))
+	}
+	annotateList := func(list []ast.Stmt) {
+		for _, stmt := range list {
+			annotate(stmt, p.Stmts[stmt])
+		}
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				// Annotate the function with a trailing comment after
+				// the opening brace, or after the closing brace if the
+				// body is on a single line.
+				line := rawLine(tf, n.Body.Lbrace)
+				at := n.Body.Lbrace + 1
+				if rawLine(tf, n.Body.Rbrace) == line {
+					at = n.Body.Rbrace + 1
+				}
+				done[line] = true
+				cmap[n] = append(cmap[n], coverageComment(at, p.Funcs[n]))
+			}
+		case *ast.BlockStmt:
+			annotateList(n.List)
+		case *ast.CaseClause:
+			annotateList(n.Body)
+		case *ast.CommClause:
+			annotateList(n.Body)
+		}
+		return true
+	})
+	f.Comments = cmap.Comments()
+}
+
+// coverageComment returns a comment group at pos describing
+// whether something was covered.
+func coverageComment(pos token.Pos, covered bool) *ast.CommentGroup {
+	text := "// NOT COVERED"
+	if covered {
+		text = "// COVERED"
+	}
+	return &ast.CommentGroup{List: []*ast.Comment{{Slash: pos, Text: text}}}
+}
+
+// clauseColon returns the position of the colon of node if it is a case
+// or comm clause, or token.NoPos otherwise.
+func clauseColon(node ast.Node) token.Pos {
+	switch n := node.(type) {
+	case *ast.CaseClause:
+		return n.Colon
+	case *ast.CommClause:
+		return n.Colon
+	}
+	return token.NoPos
+}
@@ -0,0 +1,57 @@
+package discover
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestAnnotate(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Annotate(f)
+
+	// The clauses are annotated after their colons, so that the
+	// annotations do not read as part of the previous clause.
+	checkFunc(t, p, f, "Select", `
+// Select receives from c if a value is ready.
+func Select(c chan int) int { // COVERED
+	// COVERED
+	select {
+	case v := <-c: // NOT COVERED
+		// NOT COVERED
+		return v
+	default: // COVERED
+	}
+	// COVERED
+	return 0
+}`)
+
+	var buf bytes.Buffer
+	if err := p.WriteFile(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", buf.Bytes(), 0); err != nil {
+		t.Errorf("annotated file does not parse: %v\n%s", err, buf.Bytes())
+	}
+}
+
+func TestAnnotateLineDirectives(t *testing.T) {
+	p := loadTestdata(t, "linedir")
+	f := testFile(t, p, "gen.go")
+	p.Annotate(f)
+
+	// The annotations are placed by raw line, ignoring the directives.
+	checkFunc(t, p, f, "Eval", `
+//line calc.y:10
+func Eval(x int) int { // COVERED
+	// COVERED
+	if x < 0 {
+		// NOT COVERED
+		return -x
+	}
+	// COVERED
+	return x
+}`)
+}
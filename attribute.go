@@ -0,0 +1,59 @@
+package discover
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// Attribute parses the coverage profiles of individual tests, keyed by
+// test name, and attributes each covered function to the tests that
+// reached it. The returned *Profile holds the combined coverage of all
+// tests, and the returned map lists the names of the tests that covered
+// each function, in sorted order.
+//
+// Each file is only parsed once, so the profiles of all tests refer to
+// the same ASTs. The combined profile is as if ParseProfile had been
+// given the profiles of all tests: the hit counts of the functions are
+// summed over the tests, and blocks matching nothing are reported by
+// Unmatched once per test.
+func Attribute(tests map[string][]*cover.Profile) (*Profile, map[*ast.FuncDecl][]string, error) {
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type extents struct {
+		funcs []*funcExtent
+		stmts []*stmtExtent
+	}
+	profile := newProfile(token.NewFileSet())
+	files := make(map[string]*extents)
+	attr := make(map[*ast.FuncDecl][]string)
+
+	for _, name := range names {
+		for _, prof := range tests[name] {
+			ext := files[prof.FileName]
+			if ext == nil {
+				_, funcs, stmts, err := profile.loadFile(prof.FileName)
+				if err != nil {
+					return nil, nil, err
+				}
+				ext = &extents{funcs: funcs, stmts: stmts}
+				files[prof.FileName] = ext
+			}
+
+			profile.addCoverage(prof, ext.funcs, ext.stmts)
+			for _, fn := range coveredFuncDecls(ext.funcs, prof.Blocks) {
+				if tests := attr[fn]; len(tests) == 0 || tests[len(tests)-1] != name {
+					attr[fn] = append(tests, name)
+				}
+			}
+		}
+	}
+	profile.sortFiles()
+	return profile, attr, nil
+}
@@ -0,0 +1,93 @@
+package discover
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestAttribute(t *testing.T) {
+	profs, err := cover.ParseProfiles(filepath.Join("testdata", "trim", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A block past the end of the file matches nothing.
+	profs[0].Blocks = append(profs[0].Blocks, cover.ProfileBlock{
+		StartLine: 1000, StartCol: 2, EndLine: 1000, EndCol: 10, NumStmt: 1, Count: 1,
+	})
+	want, err := ParseProfile(profs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The profile of a single test is the same as that of ParseProfile.
+	got, attr, err := Attribute(map[string][]*cover.Profile{"TestAll": profs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := coverageSummary(got), coverageSummary(want); !reflect.DeepEqual(g, w) {
+		t.Errorf("Attribute coverage = %v, want %v", g, w)
+	}
+	if g, w := got.Unmatched(), want.Unmatched(); !reflect.DeepEqual(g, w) {
+		t.Errorf("Attribute unmatched = %v, want %v", g, w)
+	}
+	for fn := range got.Funcs {
+		if tests := attr[fn]; !reflect.DeepEqual(tests, []string{"TestAll"}) {
+			t.Errorf("%s attributed to %v, want [TestAll]", FuncName(fn), tests)
+		}
+	}
+
+	// A second test covering only Covered and helper adds to their hits.
+	var other []cover.ProfileBlock
+	f := testFile(t, want, "trim.go")
+	for _, b := range profs[0].Blocks {
+		if b.StartLine <= want.Fset.Position(funcDecl(f, "helper").End()).Line {
+			other = append(other, b)
+		}
+	}
+	two, attr, err := Attribute(map[string][]*cover.Profile{
+		"TestAll":   profs,
+		"TestFirst": {{FileName: profs[0].FileName, Mode: profs[0].Mode, Blocks: other}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = testFile(t, two, "trim.go")
+	for name, tests := range map[string][]string{
+		"Covered": {"TestAll", "TestFirst"},
+		"helper":  {"TestAll", "TestFirst"},
+		"Ranges":  {"TestAll"},
+	} {
+		fn := funcDecl(f, name)
+		if !reflect.DeepEqual(attr[fn], tests) {
+			t.Errorf("%s attributed to %v, want %v", name, attr[fn], tests)
+		}
+		if got, want := two.hits[fn], len(tests); got != want {
+			t.Errorf("%s hits = %d, want %d", name, got, want)
+		}
+	}
+}
+
+// summary is the coverage of a profile, independent of its ASTs.
+type summary struct {
+	hits  map[string]int // of the covered functions by FuncName
+	stmts int            // number of covered statements
+}
+
+// coverageSummary returns the summary of the coverage of p.
+func coverageSummary(p *Profile) summary {
+	s := summary{hits: make(map[string]int)}
+	for fn, covered := range p.Funcs {
+		if covered {
+			s.hits[FuncName(fn)] = p.hits[fn]
+		}
+	}
+	for _, covered := range p.Stmts {
+		if covered {
+			s.stmts++
+		}
+	}
+	return s
+}
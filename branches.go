@@ -0,0 +1,63 @@
+package discover
+
+import "go/ast"
+
+// BranchCoverage describes which branches of an if, switch or select
+// statement were taken.
+type BranchCoverage struct {
+	Reached  bool     // whether the statement itself was reached
+	Branches []Branch // in source order
+}
+
+// Branch is a single branch of a statement with BranchCoverage.
+type Branch struct {
+	// Stmt starts the branch: the body or else branch of an if
+	// statement, or a clause of a switch or select statement.
+	Stmt  ast.Stmt
+	Taken bool
+}
+
+// Branches returns the coverage of the branches of every if, switch, type
+// switch and select statement in the parsed files, keyed by statement.
+//
+// Each branch is a block of its own in the cover profile, so whether it
+// was taken follows from the same block matching as Stmts. An if statement
+// without an else branch only has its body as a branch, since the profile
+// cannot tell whether its condition was ever false. Else-if chains are
+// reported as nested if statements.
+//
+// Since trimming removes the branches that were not taken, Branches
+// should be called before the files are trimmed.
+func (p *Profile) Branches() map[ast.Node]BranchCoverage {
+	branches := make(map[ast.Node]BranchCoverage)
+	for _, f := range p.Files {
+		info := p.files[f]
+		if info == nil {
+			continue
+		}
+		for _, se := range info.stmts {
+			var list []ast.Stmt
+			switch s := se.stmt.(type) {
+			case *ast.IfStmt:
+				list = append(list, s.Body)
+				if s.Else != nil {
+					list = append(list, s.Else)
+				}
+			case *ast.SwitchStmt:
+				list = s.Body.List
+			case *ast.TypeSwitchStmt:
+				list = s.Body.List
+			case *ast.SelectStmt:
+				list = s.Body.List
+			default:
+				continue
+			}
+			bc := BranchCoverage{Reached: p.Stmts[se.stmt]}
+			for _, stmt := range list {
+				bc.Branches = append(bc.Branches, Branch{Stmt: stmt, Taken: p.Stmts[stmt]})
+			}
+			branches[se.stmt] = bc
+		}
+	}
+	return branches
+}
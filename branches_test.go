@@ -0,0 +1,64 @@
+package discover
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+func TestBranches(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	branches := p.Branches()
+
+	// describe returns the coverage of the branching statements of the
+	// function in f with the given name, in source order, such as
+	// "if [+ -]" for an if statement whose body was taken and whose
+	// else branch was not. Unreached statements are marked with a "!".
+	describe := func(name string) []string {
+		var got []string
+		ast.Inspect(funcDecl(f, name), func(n ast.Node) bool {
+			bc, ok := branches[n]
+			if !ok {
+				return true
+			}
+			s := fmt.Sprintf("%T", n)[len("*ast."):]
+			if !bc.Reached {
+				s += "!"
+			}
+			s += " ["
+			for i, b := range bc.Branches {
+				if i > 0 {
+					s += " "
+				}
+				if b.Taken {
+					s += "+"
+				} else {
+					s += "-"
+				}
+			}
+			got = append(got, s+"]")
+			return true
+		})
+		return got
+	}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		// Clamp(-1) jumps past the second if statement.
+		{"Clamp", []string{"IfStmt [+]", "IfStmt! [-]", "IfStmt [-]"}},
+		{"Sign", []string{"SwitchStmt [+ - +]"}},
+		// Grade(50) takes the else branch of the else-if chain.
+		{"Grade", []string{"IfStmt [- +]", "IfStmt [- +]"}},
+		{"Kind", []string{"TypeSwitchStmt [-]", "TypeSwitchStmt [+]"}},
+		{"Select", []string{"SelectStmt [- +]"}},
+		{"Covered", nil},
+	}
+	for _, tt := range tests {
+		if got := describe(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("branches of %s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
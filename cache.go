@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"go/ast"
+	"go/token"
+	"os"
+	"sync"
+	"time"
+)
+
+// A FileCache caches parsed files across calls to ParseProfileOptions,
+// so that files that have not changed since they were last parsed are not
+// parsed again. A file is considered unchanged if its modification time
+// and size are the same. All profiles parsed using the same FileCache
+// share the cache's FileSet.
+//
+// Each Profile gets its own copy of the cached ASTs, so the files of a
+// Profile may be trimmed without affecting later calls. Since files cannot
+// be removed from a token.FileSet, the FileSet grows with every file
+// parsed, including each reparse of a changed file. Long-running programs
+// should replace their FileCache from time to time to release them.
+//
+// A FileCache is safe for concurrent use.
+type FileCache struct {
+	fset *token.FileSet
+
+	mu    sync.Mutex
+	files map[string]*cachedFile
+}
+
+// cachedFile is a parsed file in a FileCache.
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	file    *ast.File
+	funcs   []*funcExtent
+	stmts   []*stmtExtent
+}
+
+// NewFileCache returns a new, empty FileCache.
+func NewFileCache() *FileCache {
+	return &FileCache{
+		fset:  token.NewFileSet(),
+		files: make(map[string]*cachedFile),
+	}
+}
+
+// findFuncs is like the findFuncs function, but reuses the cached
+// result if the file has not changed. It returns a copy of the cached
+// result, which the caller may modify.
+func (c *FileCache) findFuncs(name string) (*ast.File, []*funcExtent, []*stmtExtent, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cf := c.files[name]; cf != nil && cf.modTime.Equal(fi.ModTime()) && cf.size == fi.Size() {
+		f, funcs, stmts := cf.copy()
+		return f, funcs, stmts, nil
+	}
+
+	f, funcs, stmts, err := findFuncs(c.fset, name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cf := &cachedFile{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		file:    f,
+		funcs:   funcs,
+		stmts:   stmts,
+	}
+	c.files[name] = cf
+	f, funcs, stmts = cf.copy()
+	return f, funcs, stmts, nil
+}
+
+// copy returns a deep copy of the parsed file along with its extents.
+func (cf *cachedFile) copy() (*ast.File, []*funcExtent, []*stmtExtent) {
+	c := newCloner()
+	f := c.node(cf.file).(*ast.File)
+	funcs, stmts := c.extents(cf.funcs, cf.stmts)
+	return f, funcs, stmts
+}
@@ -0,0 +1,76 @@
+package discover
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "trim", "trim.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "trim.go")
+	if err := ioutil.WriteFile(name, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/trim\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profs, err := cover.ParseProfiles(filepath.Join("testdata", "trim", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profs[0].FileName = name
+
+	opts := &Options{Cache: NewFileCache()}
+	parse := func() (*Profile, *bytes.Buffer) {
+		t.Helper()
+		p, err := ParseProfileOptions(profs, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := p.WriteFile(&buf, p.Files[0]); err != nil {
+			t.Fatal(err)
+		}
+		return p, &buf
+	}
+
+	p1, want := parse()
+	f1 := p1.Files[0]
+	p1.Trim(f1)
+
+	// Trimming the first profile must not affect the cached file.
+	p2, got := parse()
+	f2 := p2.Files[0]
+	if f2 == f1 {
+		t.Fatal("cached file was not copied")
+	}
+	if got.String() != want.String() {
+		t.Errorf("cached file was modified by trimming:\n%s", got)
+	}
+	if !p2.Funcs[funcDecl(f2, "Covered")] {
+		t.Error("Covered is not covered in the copy of the cached file")
+	}
+	if p2.Fset.File(f2.Pos()) != p1.Fset.File(f1.Pos()) {
+		t.Error("unchanged file was parsed again")
+	}
+
+	// A changed file is parsed again.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(name, later, later); err != nil {
+		t.Fatal(err)
+	}
+	p3, _ := parse()
+	if p3.Fset.File(p3.Files[0].Pos()) == p1.Fset.File(f1.Pos()) {
+		t.Error("changed file was not parsed again")
+	}
+}
@@ -0,0 +1,206 @@
+package discover
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// CallGraph returns, for each covered function, the names of the functions
+// it calls, in order of first appearance and without duplicates.
+//
+// Names are resolved textually since no type information is available.
+// Calls to plain identifiers resolve to the identifier ("helper"), and
+// calls through a selector resolve to their source form ("pkg.Func",
+// "recv.Method" or "s.field.Method"). Calls of function literals and
+// of predeclared functions such as len and append are omitted.
+func (p *Profile) CallGraph() map[*ast.FuncDecl][]string {
+	graph := make(map[*ast.FuncDecl][]string)
+	for _, fn := range p.coveredFuncs() {
+		if fn.Body != nil {
+			graph[fn] = callees(fn.Body)
+		}
+	}
+	return graph
+}
+
+// callees returns the names of the functions called within node.
+func callees(node ast.Node) []string {
+	var names []string
+	seen := make(map[string]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if name := calleeName(call.Fun); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return true
+	})
+	return names
+}
+
+// calleeName returns the textual name of the function called by
+// an expression in call position, or "" if it has no useful name.
+func calleeName(fun ast.Expr) string {
+	switch fun := fun.(type) {
+	case *ast.ParenExpr:
+		return calleeName(fun.X)
+	case *ast.Ident:
+		if fun.Obj == nil && types.Universe.Lookup(fun.Name) != nil {
+			// Predeclared function or type conversion
+			return ""
+		}
+		return fun.Name
+	case *ast.SelectorExpr:
+		return types.ExprString(fun)
+	}
+	return ""
+}
+
+// OrderByDepth returns the covered functions ordered by their distance
+// from the entry points of the call graph, so that entry points (typically
+// the functions called directly by tests) come first and leaf helpers last.
+// Functions at the same depth are kept in source order.
+//
+// Entry points are covered functions not called by any other covered
+// function. Functions only reachable through cycles are treated as
+// additional entry points.
+func (p *Profile) OrderByDepth() []*ast.FuncDecl {
+	order, _ := p.depthTree()
+	return order
+}
+
+// depthTree returns the covered functions in the order of OrderByDepth,
+// along with the caller through which the breadth-first search reached
+// each of them. Entry points have no caller.
+func (p *Profile) depthTree() (order []*ast.FuncDecl, caller map[*ast.FuncDecl]*ast.FuncDecl) {
+	funcs := p.coveredFuncs()
+	edges := p.callEdges()
+
+	called := make(map[*ast.FuncDecl]bool)
+	for caller, list := range edges {
+		for _, callee := range list {
+			if callee != caller {
+				called[callee] = true
+			}
+		}
+	}
+
+	caller = make(map[*ast.FuncDecl]*ast.FuncDecl)
+	seen := make(map[*ast.FuncDecl]bool)
+	bfs := func(roots []*ast.FuncDecl) {
+		queue := roots
+		for _, fn := range roots {
+			seen[fn] = true
+		}
+		for len(queue) > 0 {
+			fn := queue[0]
+			queue = queue[1:]
+			order = append(order, fn)
+			for _, callee := range edges[fn] {
+				if !seen[callee] {
+					seen[callee] = true
+					caller[callee] = fn
+					queue = append(queue, callee)
+				}
+			}
+		}
+	}
+
+	var roots []*ast.FuncDecl
+	for _, fn := range funcs {
+		if !called[fn] {
+			roots = append(roots, fn)
+		}
+	}
+	bfs(roots)
+	for _, fn := range funcs {
+		if !seen[fn] {
+			bfs([]*ast.FuncDecl{fn})
+		}
+	}
+	return order, caller
+}
+
+// Reachable returns the covered functions reachable from the given roots
+// through the call graph, including the roots themselves. As with
+// OrderByDepth, calls are resolved on a best-effort basis by name.
+func (p *Profile) Reachable(roots ...*ast.FuncDecl) map[*ast.FuncDecl]bool {
+	edges := p.callEdges()
+	seen := make(map[*ast.FuncDecl]bool)
+	stack := append([]*ast.FuncDecl(nil), roots...)
+	for len(stack) > 0 {
+		fn := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[fn] {
+			continue
+		}
+		seen[fn] = true
+		stack = append(stack, edges[fn]...)
+	}
+	return seen
+}
+
+// coveredFuncs returns the covered function declarations in source order.
+func (p *Profile) coveredFuncs() []*ast.FuncDecl {
+	var funcs []*ast.FuncDecl
+	for _, f := range p.Files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && p.Funcs[fn] {
+				funcs = append(funcs, fn)
+			}
+		}
+	}
+	return funcs
+}
+
+// callEdges resolves the names in the call graph to covered functions.
+// Plain identifiers resolve to functions of the same package, while
+// selectors resolve to any covered function or method with the selected
+// name, making the result a best-effort over-approximation.
+func (p *Profile) callEdges() map[*ast.FuncDecl][]*ast.FuncDecl {
+	pkgOf := make(map[*ast.FuncDecl]string)
+	funcsByName := make(map[string][]*ast.FuncDecl)   // top-level funcs
+	membersByName := make(map[string][]*ast.FuncDecl) // funcs and methods
+	for _, f := range p.Files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || !p.Funcs[fn] {
+				continue
+			}
+			pkgOf[fn] = p.ImportPaths[f]
+			name := fn.Name.Name
+			if fn.Recv == nil {
+				funcsByName[name] = append(funcsByName[name], fn)
+			}
+			membersByName[name] = append(membersByName[name], fn)
+		}
+	}
+
+	edges := make(map[*ast.FuncDecl][]*ast.FuncDecl)
+	for caller, names := range p.CallGraph() {
+		seen := make(map[*ast.FuncDecl]bool)
+		for _, name := range names {
+			var candidates []*ast.FuncDecl
+			if i := strings.LastIndexByte(name, '.'); i >= 0 {
+				candidates = membersByName[name[i+1:]]
+			} else {
+				for _, fn := range funcsByName[name] {
+					if pkgOf[fn] == pkgOf[caller] {
+						candidates = append(candidates, fn)
+					}
+				}
+			}
+			for _, fn := range candidates {
+				if !seen[fn] {
+					seen[fn] = true
+					edges[caller] = append(edges[caller], fn)
+				}
+			}
+		}
+	}
+	return edges
+}
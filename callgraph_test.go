@@ -0,0 +1,45 @@
+package discover
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCallGraph(t *testing.T) {
+	p := loadTestdata(t, "calls")
+	got := make(map[string][]string)
+	for fn, callees := range p.CallGraph() {
+		got[FuncName(fn)] = callees
+	}
+
+	// Predeclared functions and function literals are left out, and
+	// uncovered functions have no entry.
+	want := map[string][]string{
+		"Run":  {"a", "b"},
+		"a":    {"c"},
+		"b":    {"s.M", "c"},
+		"c":    nil,
+		"S.M":  nil,
+		"ping": {"pong"},
+		"pong": {"ping"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CallGraph() = %v, want %v", got, want)
+	}
+}
+
+func TestOrderByDepth(t *testing.T) {
+	p := loadTestdata(t, "calls")
+	var got []string
+	for _, fn := range p.OrderByDepth() {
+		got = append(got, FuncName(fn))
+	}
+
+	// Run is the only function not called by another. The functions
+	// only reachable through the cycle of ping and pong follow, starting
+	// with the first in source order.
+	want := []string{"Run", "a", "b", "c", "S.M", "ping", "pong"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OrderByDepth() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+package discover
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+)
+
+// Clone returns a deep copy of p, with copies of the ASTs of its files and
+// of the maps referring to them. Since Trim, Annotate and AddLineDirectives
+// modify the ASTs in place, calling them on the same Profile concurrently
+// is not safe. Instead, give each goroutine a clone to modify.
+//
+// The FileSet, the parse options and the types of TypesInfo are shared
+// with p, as they are not modified after parsing. The other methods of
+// Profile only read p, and may be called concurrently with each other.
+func (p *Profile) Clone() *Profile {
+	c := newCloner()
+	clone := *p
+	clone.Files = nil
+	clone.Stmts = make(map[ast.Stmt]bool, len(p.Stmts))
+	clone.Funcs = make(map[*ast.FuncDecl]bool, len(p.Funcs))
+	clone.ImportPaths = make(map[*ast.File]string, len(p.ImportPaths))
+	clone.Skipped = append([]SkippedFile(nil), p.Skipped...)
+	clone.files = make(map[*ast.File]*fileInfo, len(p.files))
+	clone.hits = make(map[*ast.FuncDecl]int, len(p.hits))
+	clone.unmatched = append([]UnmatchedBlock(nil), p.unmatched...)
+
+	for _, f := range p.Files {
+		clone.Files = append(clone.Files, c.node(f).(*ast.File))
+	}
+	for stmt, covered := range p.Stmts {
+		clone.Stmts[c.node(stmt).(ast.Stmt)] = covered
+	}
+	for fn, covered := range p.Funcs {
+		clone.Funcs[c.node(fn).(*ast.FuncDecl)] = covered
+	}
+	for fn, count := range p.hits {
+		clone.hits[c.node(fn).(*ast.FuncDecl)] = count
+	}
+	for f, path := range p.ImportPaths {
+		clone.ImportPaths[c.node(f).(*ast.File)] = path
+	}
+	for f, info := range p.files {
+		ci := &fileInfo{name: info.name}
+		ci.funcs, ci.stmts = c.extents(info.funcs, info.stmts)
+		clone.files[c.node(f).(*ast.File)] = ci
+	}
+	if p.usage != nil {
+		clone.usage = make(map[string]*pkgUsage, len(p.usage))
+		for path, u := range p.usage {
+			clone.usage[path] = c.pkgUsage(u)
+		}
+	}
+	if p.TypesInfo != nil {
+		clone.TypesInfo = c.typesInfo(p.TypesInfo)
+	}
+	return &clone
+}
+
+// cloner deep-copies ASTs, copying each node only once so that nodes
+// referred to from several places (such as through ast.Object) remain
+// shared within the copy.
+type cloner struct {
+	seen map[cloneKey]reflect.Value
+}
+
+// newCloner returns a cloner that has not copied anything yet.
+func newCloner() *cloner {
+	return &cloner{seen: make(map[cloneKey]reflect.Value)}
+}
+
+// cloneKey identifies a pointer that has been copied.
+type cloneKey struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+// node returns the copy of n.
+func (c *cloner) node(n ast.Node) ast.Node {
+	return c.copy(reflect.ValueOf(n)).Interface().(ast.Node)
+}
+
+// extents returns copies of funcs and stmts referring to the copied nodes.
+func (c *cloner) extents(funcs []*funcExtent, stmts []*stmtExtent) ([]*funcExtent, []*stmtExtent) {
+	var cfuncs []*funcExtent
+	for _, fe := range funcs {
+		cfe := *fe
+		cfe.decl = c.node(fe.decl).(*ast.FuncDecl)
+		cfuncs = append(cfuncs, &cfe)
+	}
+	var cstmts []*stmtExtent
+	for _, se := range stmts {
+		cse := *se
+		cse.stmt = c.node(se.stmt).(ast.Stmt)
+		cstmts = append(cstmts, &cse)
+	}
+	return cfuncs, cstmts
+}
+
+// pkgUsage returns a copy of u referring to the copied type specs.
+func (c *cloner) pkgUsage(u *pkgUsage) *pkgUsage {
+	cu := &pkgUsage{methodTypes: u.methodTypes}
+	if u.fields != nil {
+		cu.fields = make(map[*ast.TypeSpec][]string, len(u.fields))
+		for ts, names := range u.fields {
+			cu.fields[c.node(ts).(*ast.TypeSpec)] = names
+		}
+	}
+	return cu
+}
+
+// typesInfo returns a copy of info whose maps are keyed by the copied
+// nodes. The types and objects themselves are shared.
+func (c *cloner) typesInfo(info *types.Info) *types.Info {
+	clone := &types.Info{}
+	src, dst := reflect.ValueOf(info).Elem(), reflect.ValueOf(clone).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		m := src.Field(i)
+		if m.Kind() != reflect.Map || m.IsNil() {
+			continue
+		}
+		cm := reflect.MakeMapWithSize(m.Type(), m.Len())
+		iter := m.MapRange()
+		for iter.Next() {
+			cm.SetMapIndex(c.copy(iter.Key()), iter.Value())
+		}
+		dst.Field(i).Set(cm)
+	}
+	return clone
+}
+
+// copy returns a deep copy of v. Functions and channels are shared, as
+// are unexported struct fields, which reflection cannot set.
+func (c *cloner) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := cloneKey{v.Type(), v.Pointer()}
+		if cv, ok := c.seen[key]; ok {
+			return cv
+		}
+		cv := reflect.New(v.Type().Elem())
+		c.seen[key] = cv // before copying, in case of cycles
+		cv.Elem().Set(c.copy(v.Elem()))
+		return cv
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cv := reflect.New(v.Type()).Elem()
+		cv.Set(c.copy(v.Elem()))
+		return cv
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cv := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cv.Index(i).Set(c.copy(v.Index(i)))
+		}
+		return cv
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cv := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			cv.SetMapIndex(c.copy(iter.Key()), c.copy(iter.Value()))
+		}
+		return cv
+
+	case reflect.Struct:
+		cv := reflect.New(v.Type()).Elem()
+		cv.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if cv.Field(i).CanSet() {
+				cv.Field(i).Set(c.copy(v.Field(i)))
+			}
+		}
+		return cv
+	}
+	return v
+}
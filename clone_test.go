@@ -0,0 +1,73 @@
+package discover
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestCloneConcurrentTrim(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+
+	trim := func(p *Profile) (string, error) {
+		c := p.Clone()
+		var buf bytes.Buffer
+		for _, f := range c.Files {
+			c.Trim(f)
+			if err := c.WriteFile(&buf, f); err != nil {
+				return "", err
+			}
+		}
+		return buf.String(), nil
+	}
+	want, err := trim(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lcov bytes.Buffer
+	if err := p.WriteLCOV(&lcov); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each goroutine trims its own clone, while others only read p.
+	// Run with -race to check that they do not share anything modified.
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			got, err := trim(p)
+			if err != nil {
+				errs <- err
+			} else if got != want {
+				t.Errorf("concurrent trim differs:\n%s\nwant:\n%s", got, want)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			p.Branches()
+			p.CallGraph()
+			p.PackageCoverage()
+			p.HasCoverage(f)
+			var buf bytes.Buffer
+			if err := p.WriteLCOV(&buf); err != nil {
+				errs <- err
+			} else if buf.String() != lcov.String() {
+				t.Errorf("concurrent WriteLCOV differs:\n%s\nwant:\n%s", buf.String(), lcov.String())
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// The original is left untouched.
+	if funcDecl(f, "unused") == nil {
+		t.Error("trimming a clone trimmed the original")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/eandre/discover"
+	"golang.org/x/tools/cover"
+)
+
+// testNameRe matches the test names printed by "go test -list".
+var testNameRe = regexp.MustCompile(`^(Test|Example|Fuzz)\w*$`)
+
+// attributeTests runs each test matching testRegexp on its own and prints,
+// for every covered function, the names of the tests that covered it.
+func attributeTests(ctx context.Context, testRegexp string) error {
+	names, err := listTests(ctx, testRegexp)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return errors.New("No tests found")
+	}
+
+	tmpDir, err := ioutil.TempDir(*tempDir, "discover")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := make(map[string][]*cover.Profile)
+	for i, name := range names {
+		profilePath := filepath.Join(tmpDir, fmt.Sprintf("coverprofile%d.out", i))
+		if err := goTest(ctx, profilePath, "^"+regexp.QuoteMeta(name)+"$"); err != nil {
+			return err
+		}
+		profiles, err := cover.ParseProfiles(profilePath)
+		if err != nil {
+			return err
+		}
+		tests[name] = profiles
+	}
+
+	prof, attr, err := discover.Attribute(tests)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range prof.Files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && prof.Funcs[fn] {
+				fmt.Printf("%s: %s\n", qualifiedName(prof, fn), strings.Join(attr[fn], ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// listTests returns the names of the tests matching testRegexp,
+// as reported by "go test -list" or the test binary given by -exec.
+func listTests(ctx context.Context, testRegexp string) ([]string, error) {
+	if testRegexp == "" {
+		testRegexp = "."
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", "test", "-list", testRegexp)
+	if *exe != "" {
+		cmd = exec.CommandContext(ctx, *exe, "-test.list", testRegexp)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	sc := bufio.NewScanner(&stdout)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); testNameRe.MatchString(line) {
+			names = append(names, line)
+		}
+	}
+	return names, sc.Err()
+}
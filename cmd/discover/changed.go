@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedFiles returns the absolute paths of the files that differ from
+// the given git revision, according to "git diff --name-only".
+func changedFiles(ctx context.Context, base string) (map[string]bool, error) {
+	root, err := gitOutput(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("-changed requires running within a git repository: %v", err)
+	}
+	names, err := gitOutput(ctx, "diff", "--name-only", base, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool)
+	for _, name := range strings.Split(names, "\n") {
+		if name != "" {
+			files[realPath(filepath.Join(root, filepath.FromSlash(name)))] = true
+		}
+	}
+	return files, nil
+}
+
+// gitOutput runs git with the given arguments and returns its trimmed output.
+func gitOutput(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// realPath returns name with any symbolic links resolved,
+// or name itself if that fails.
+func realPath(name string) string {
+	if p, err := filepath.EvalSymlinks(name); err == nil {
+		return p
+	}
+	return name
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	root := realPath(t.TempDir())
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, data string) {
+		t.Helper()
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("a.go", "package p\n")
+	write("sub/b.go", "package sub\n")
+	write("sub/c.go", "package sub\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	write("sub/b.go", "package sub // changed\n")
+
+	// Run from a subdirectory, reached through a symbolic link.
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(filepath.Join(root, "sub"), link); err != nil {
+		t.Skip(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(link); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := changedFiles(context.Background(), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{filepath.Join(root, "sub", "b.go"): true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFiles = %v, want %v", got, want)
+	}
+	// The files of the profile are matched by their real paths.
+	if name := realPath(filepath.Join(link, "b.go")); !got[name] {
+		t.Errorf("%s is not among the changed files", name)
+	}
+	if name := filepath.Join(link, "missing.go"); realPath(name) != name {
+		t.Errorf("realPath(%q) = %q, want it unchanged", name, realPath(name))
+	}
+
+	if _, err := changedFiles(context.Background(), "no-such-revision"); err == nil {
+		t.Error("changedFiles succeeded for an unknown revision")
+	}
+}
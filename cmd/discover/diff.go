@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+
+	"github.com/eandre/discover"
+)
+
+// diffProfiles parses two cover profiles and prints the functions
+// covered by only one of them.
+func diffProfiles(oldName, newName string) error {
+	oldProf, err := loadProfile(oldName)
+	if err != nil {
+		return err
+	}
+	newProf, err := loadProfile(newName)
+	if err != nil {
+		return err
+	}
+
+	added, removed := oldProf.Diff(newProf)
+	for _, fn := range removed {
+		fmt.Printf("- %s\n", qualifiedName(oldProf, fn))
+	}
+	for _, fn := range added {
+		fmt.Printf("+ %s\n", qualifiedName(newProf, fn))
+	}
+	return nil
+}
+
+// qualifiedName returns the name of fn qualified by the import path
+// of the package it is declared in.
+func qualifiedName(prof *discover.Profile, fn *ast.FuncDecl) string {
+	for _, f := range prof.Files {
+		if f.Pos() <= fn.Pos() && fn.End() <= f.End() {
+			return prof.ImportPaths[f] + "." + discover.FuncName(fn)
+		}
+	}
+	return discover.FuncName(fn)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"sort"
+)
+
+// listFuncs parses a cover profile and writes every function in it to w,
+// grouped by package, along with its position and whether it was covered.
+func listFuncs(w io.Writer, fileName string) error {
+	prof, err := loadProfile(fileName)
+	if err != nil {
+		return err
+	}
+
+	files := append([]*ast.File(nil), prof.Files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return prof.ImportPaths[files[i]] < prof.ImportPaths[files[j]]
+	})
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			status := "UNCOVERED"
+			if prof.Funcs[fn] {
+				status = "COVERED"
+			}
+			pos := prof.Fset.Position(fn.Pos())
+			fmt.Fprintf(w, "%-9s %s %s:%d\n", status, qualifiedName(prof, fn), pos.Filename, pos.Line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestListFuncs(t *testing.T) {
+	// A profile of two packages, listed in reverse order.
+	var data []byte
+	for _, name := range []string{"fields", "calls"} {
+		b, err := ioutil.ReadFile(filepath.Join("..", "..", "testdata", name, "cover.out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != nil {
+			b = b[bytes.IndexByte(b, '\n')+1:] // drop the mode line
+		}
+		data = append(data, b...)
+	}
+	name := filepath.Join(t.TempDir(), "cover.out")
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := listFuncs(&buf, name); err != nil {
+		t.Fatal(err)
+	}
+	// Drop the directories of the import paths and file names.
+	got := regexp.MustCompile(` \S*/`).ReplaceAllString(buf.String(), " ")
+	want := `COVERED   calls.Run calls.go:8
+COVERED   calls.a calls.go:12
+COVERED   calls.b calls.go:16
+COVERED   calls.c calls.go:21
+COVERED   calls.S.M calls.go:29
+UNCOVERED calls.unused calls.go:33
+COVERED   calls.ping calls.go:39
+COVERED   calls.pong calls.go:46
+COVERED   fields.Sum a.go:9
+COVERED   fields.T.Total a.go:16
+UNCOVERED fields.T.Reset b.go:9
+`
+	if got != want {
+		t.Errorf("listFuncs output:\n%s\nwant:\n%s", got, want)
+	}
+}
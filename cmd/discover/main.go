@@ -1,20 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
-	"go/format"
+	"go/build"
+	"go/parser"
+	"go/printer"
 	"go/token"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/eandre/discover"
 	"golang.org/x/tools/cover"
+	"golang.org/x/tools/imports"
 )
 
 func usage() {
@@ -26,16 +35,86 @@ The commands are:
 		Runs "go test -run <testRegexp>" to output a cover profile,
 		and then parses it and outputs the result.
 
+	discover [-output=<dir>] -exec=<test binary> test [<testRegexp>]
+		Like test, but runs an already-built test binary (as built by
+		"go test -c -cover") instead of "go test".
+
 	discover [-output=<dir>] parse <cover profile>
 		Parses the given cover profile and outputs the result.
 
-For both commands, the output flag specifies a directory to write files to,
+	discover [-output=<dir>] -covdata=<dir> parse
+		Converts the binary coverage data in the given GOCOVERDIR
+		directory using "go tool covdata" and outputs the result.
+
+	discover diff <old cover profile> <new cover profile>
+		Lists the functions covered by only one of the two profiles,
+		prefixed by "-" if only covered by the old one and "+" if
+		only covered by the new one.
+
+	discover list <cover profile>
+		Lists every function in the cover profile with its position,
+		marked COVERED or UNCOVERED and grouped by package.
+
+	discover [-http=<addr>] serve <cover profile>
+		Serves the trimmed files of the cover profile as HTML,
+		browsable by package.
+
+	discover attribute [<testRegexp>]
+		Runs each test matching <testRegexp> individually and lists,
+		for each covered function, the tests that reached it.
+
+For the test and parse commands, the output flag specifies a directory to write files to,
 as opposed to printing to stdout. If any of the files exist already, they will
-be overwritten.
+be overwritten. Files are written to a directory per import path, or with
+-layout=source, per source directory relative to the module root. A
+manifest.json listing the files written, along with their import paths,
+source files and function coverage, is written alongside them.
+
+Flags:
 `)
+	flag.PrintDefaults()
 }
 
-var output = flag.String("output", "", "Directory to write output files to (will overwrite existing files)")
+var (
+	output     = flag.String("output", "", "Directory to write output files to (will overwrite existing files)")
+	syncOutput = flag.Bool("sync", false, "Remove files written to -output by a previous run that are no longer output")
+	format     = flag.String("format", "files", "Output format: \"files\" for the trimmed files, or \"patch\" for a unified diff removing the trimmed code from the original source")
+	layout     = flag.String("layout", "importpath", "Directory layout of -output: \"importpath\" or \"source\" (relative to the module root)")
+	httpAddr   = flag.String("http", "localhost:6060", "Address to serve on with the serve command")
+	progress   = flag.Bool("progress", false, "Report the progress of parsing and trimming files on stderr")
+	quiet      = flag.Bool("quiet", false, "Suppress \"go test\" output unless the tests fail")
+	tempDir    = flag.String("tmpdir", "", "Directory to write temporary cover profiles to (defaults to $TMPDIR)")
+	exe        = flag.String("exec", "", "Run the given prebuilt test binary instead of \"go test\"")
+
+	keepMethods = flag.Bool("keep-methods", false, "Keep all methods of types with at least one covered method")
+	keepTypes   = flag.Bool("keep-types", false, "Keep the declarations of types with covered methods")
+	typed       = flag.Bool("types", false, "Load type information to keep the implementations of interface methods called by covered code (slower)")
+	keepExports = flag.Bool("keep-exported", false, "Keep the signatures of exported functions that were not covered, with empty bodies")
+	trimInit    = flag.Bool("trim-init", false, "Trim init functions that were not covered instead of always keeping them")
+	skipMissing = flag.Bool("skip-missing", false, "Skip files in the cover profile that no longer exist")
+	skipInvalid = flag.Bool("skip-invalid", false, "Skip files in the cover profile that fail to parse")
+	noTests     = flag.Bool("no-tests", false, "Leave test files (*_test.go) out of the output")
+	covData     = flag.String("covdata", "", "Parse binary coverage data from the given GOCOVERDIR directory")
+	srcRoot     = flag.String("src-root", "", "Locate files of the cover profile under a different root, given as \"prefix=dir\" (e.g. /ci/src/repo=. or example.com/mod=.)")
+	tags        = flag.String("tags", "", "Comma-separated list of build tags to run the tests with and resolve files by (defaults to -tags in $GOFLAGS)")
+	guards      = flag.Int("guards", 0, "Number of untaken if statements to keep around a taken else branch")
+	keepErrors  = flag.Bool("keep-errors", false, "Keep \"if err != nil\" checks returning or panicking even if they were not taken")
+	keepSpacing = flag.Bool("keep-spacing", false, "Preserve the blank lines of the original source in the output")
+	collapse    = flag.Bool("collapse", false, "Collapse runs of covered statements without calls of covered functions or control flow into a comment")
+	fieldUsage  = flag.Bool("field-usage", false, "Keep struct types whose fields are used by covered code, listing the used fields in a comment")
+	annotate    = flag.Bool("annotate", false, "Annotate statements with their coverage instead of trimming")
+	tabWidth    = flag.Int("tabwidth", 0, "Indent the output with the given number of spaces instead of tabs")
+	goimports   = flag.Bool("goimports", false, "Format the output like goimports, fixing up its imports")
+	lineDirs    = flag.Bool("line-directives", false, "Add //line directives pointing back to the original source")
+	dryRun      = flag.Bool("dry-run", false, "Only report how many files would be output and declarations trimmed per package")
+	focusFunc   = flag.String("func", "", "Only output the given function (as \"pkg.Name\" or \"pkg.Recv.Name\") and the covered functions it calls; implies -trim-init unless that is given")
+	vendored    = flag.Bool("vendor", false, "Include vendored packages (with \"/vendor/\" in their import paths) in the output")
+	moduleOnly  = flag.Bool("module-only", false, "Leave packages outside the current module (as listed by \"go list -m\") out of the output")
+	changed     = flag.String("changed", "", "Only output files that differ from the given git revision (e.g. HEAD or main)")
+	thresholds  = flag.String("thresholds", "", "JSON file mapping import paths (or \"*\") to minimum coverage percentages; fails if a package is below its threshold")
+	keepFile    = flag.String("keep", "", "File listing functions to always keep, one \"Name\" or \"Recv.Name\" per line")
+	excludeFunc = flag.String("exclude-func", "", "Leave functions matching the given regexp out of the output, matched against \"Name\" or \"Recv.Name\"")
+)
 
 func main() {
 	flag.Usage = usage
@@ -45,44 +124,84 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Cancel running tests on interrupt, leaving time to clean up.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	switch flag.Arg(0) {
 	case "test":
 		// run tests
-		if err := runTests(flag.Arg(1)); err != nil {
+		if err := runTests(ctx, flag.Arg(1)); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
 
 	case "parse":
+		if *covData != "" {
+			if err := parseCovData(ctx, *covData); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			break
+		}
+		if flag.NArg() <= 1 {
+			fmt.Fprintln(os.Stderr, "missing cover profile")
+			os.Exit(1)
+		}
+		if err := parseProfile(ctx, flag.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+	case "diff":
+		if flag.NArg() <= 2 {
+			fmt.Fprintln(os.Stderr, "missing cover profiles")
+			os.Exit(1)
+		}
+		if err := diffProfiles(flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+	case "list":
 		if flag.NArg() <= 1 {
 			fmt.Fprintln(os.Stderr, "missing cover profile")
 			os.Exit(1)
 		}
-		if err := parseProfile(flag.Arg(1)); err != nil {
+		if err := listFuncs(os.Stdout, flag.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+	case "serve":
+		if flag.NArg() <= 1 {
+			fmt.Fprintln(os.Stderr, "missing cover profile")
+			os.Exit(1)
+		}
+		if err := serveProfile(flag.Arg(1), *httpAddr); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+	case "attribute":
+		if err := attributeTests(ctx, flag.Arg(1)); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
 	}
 }
 
-func runTests(testRegexp string) error {
-	tmpDir, err := ioutil.TempDir("", "discover")
+// runTests runs the tests matching testRegexp and parses the resulting
+// cover profile. Cancelling ctx kills the tests.
+func runTests(ctx context.Context, testRegexp string) error {
+	tmpDir, err := ioutil.TempDir(*tempDir, "discover")
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(tmpDir)
 
 	profilePath := filepath.Join(tmpDir, "coverprofile.out")
-	args := []string{"test", "-coverprofile", profilePath}
-	if testRegexp != "" {
-		args = append(args, "-run", testRegexp)
-	}
-
-	cmd := exec.Command("go", args...)
-	cmd.Stdin = nil
-	cmd.Stdout = os.Stderr
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	if err := goTest(ctx, profilePath, testRegexp); err != nil {
 		return err
 	}
 
@@ -92,26 +211,135 @@ func runTests(testRegexp string) error {
 		return err
 	}
 
-	fmt.Printf("\n") // newline between "go test" output and ours
-	return parseProfile(profilePath)
+	if !*quiet {
+		fmt.Printf("\n") // newline between "go test" output and ours
+	}
+	return parseProfile(ctx, profilePath)
 }
 
-func parseProfile(fileName string) error {
-	profiles, err := cover.ParseProfiles(fileName)
+// parseCovData converts the binary coverage data in dir (as written
+// to GOCOVERDIR by Go 1.20 and later) to a cover profile and parses it.
+func parseCovData(ctx context.Context, dir string) error {
+	tmpDir, err := ioutil.TempDir(*tempDir, "discover")
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(tmpDir)
+
+	profilePath := filepath.Join(tmpDir, "coverprofile.out")
+	cmd := exec.CommandContext(ctx, "go", "tool", "covdata", "textfmt", "-i", dir, "-o", profilePath)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	return parseProfile(ctx, profilePath)
+}
+
+// goTest runs "go test", or the test binary given by -exec, writing
+// a cover profile to profilePath. If testRegexp is non-empty, only
+// the matching tests are run. Cancelling ctx kills the tests.
+func goTest(ctx context.Context, profilePath, testRegexp string) error {
+	var cmd *exec.Cmd
+	if *exe != "" {
+		args := []string{"-test.coverprofile", profilePath}
+		if testRegexp != "" {
+			args = append(args, "-test.run", testRegexp)
+		}
+		cmd = exec.CommandContext(ctx, *exe, args...)
+	} else {
+		args := []string{"test", "-coverprofile", profilePath}
+		if *tags != "" {
+			args = append(args, "-tags", *tags)
+		}
+		if testRegexp != "" {
+			args = append(args, "-run", testRegexp)
+		}
+		cmd = exec.CommandContext(ctx, "go", args...)
+	}
+
+	var buf bytes.Buffer
+	cmd.Stdin = nil
+	if *quiet {
+		cmd.Stdout = &buf
+		cmd.Stderr = &buf
+	} else {
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		os.Stderr.Write(buf.Bytes()) // only non-empty in quiet mode
+		return err
+	}
+	return nil
+}
 
-	prof, err := discover.ParseProfile(profiles)
+func parseProfile(ctx context.Context, fileName string) error {
+	if *layout != "importpath" && *layout != "source" {
+		return fmt.Errorf("invalid -layout %q: must be \"importpath\" or \"source\"", *layout)
+	}
+	if *format != "files" && *format != "patch" {
+		return fmt.Errorf("invalid -format %q: must be \"files\" or \"patch\"", *format)
+	}
+	if *format == "patch" && *output != "" {
+		return errors.New("-format=patch writes to stdout and cannot be used with -output")
+	}
+	prof, err := loadProfile(fileName)
+	if err != nil {
+		return err
+	}
+	for _, s := range prof.Skipped {
+		fmt.Fprintf(os.Stderr, "skipping %s: %v\n", s.FileName, s.Err)
+	}
+	// Count the functions before -exclude-func and -func change
+	// prof.Funcs, so that the manifest reports the original coverage.
+	counts := countFuncs(prof)
+	keep, err := selectFuncs(prof)
 	if err != nil {
 		return err
 	}
 
-	for _, f := range prof.Files {
-		prof.Trim(f)
+	var changedSet map[string]bool
+	if *changed != "" {
+		if changedSet, err = changedFiles(ctx, *changed); err != nil {
+			return err
+		}
+	}
 
-		// If we filtered out all decls, don't print at all
-		if len(f.Decls) == 0 {
+	var modules []string
+	if *moduleOnly {
+		if modules, err = currentModules(ctx); err != nil {
+			return err
+		}
+	}
+
+	var (
+		stats   dryRunStats
+		written []manifestFile // files written to -output
+	)
+	for i, f := range prof.Files {
+		if *progress {
+			reportProgress("trimmed", i, len(prof.Files))
+		}
+		if changedSet != nil && !changedSet[realPath(prof.Fset.File(f.Pos()).Name())] {
+			continue
+		}
+		if !inScope(prof.ImportPaths[f], modules) {
+			continue
+		}
+		decls := len(f.Decls)
+		emit := transformFile(prof, f, keep)
+		if *dryRun {
+			stats.add(prof.ImportPaths[f], decls, f, emit)
+			continue
+		}
+		if *format == "patch" {
+			if err := printPatch(prof, f, emit); err != nil {
+				return err
+			}
+			continue
+		}
+		if !emit {
 			continue
 		}
 
@@ -121,34 +349,423 @@ func parseProfile(fileName string) error {
 			return fmt.Errorf("No import path found for %q", fn)
 		}
 
-		if err := outputFile(importPath, fn, prof.Fset, f); err != nil {
+		target, err := outputFile(prof, importPath, fn, f)
+		if err != nil {
 			return err
 		}
+		if target != "" {
+			rel, err := filepath.Rel(*output, target)
+			if err != nil {
+				return err
+			}
+			written = append(written, manifestFile{
+				Path:         filepath.ToSlash(rel),
+				ImportPath:   importPath,
+				Source:       prof.Fset.File(f.Pos()).Name(),
+				CoveredFuncs: counts[f].covered,
+				TotalFuncs:   counts[f].total,
+			})
+		}
+	}
+	if *progress {
+		reportProgress("trimmed", len(prof.Files), len(prof.Files))
+	}
+	if *dryRun {
+		stats.print(os.Stdout)
+	}
+	if *output != "" && !*dryRun {
+		if err := writeManifest(*output, written, *syncOutput); err != nil {
+			return err
+		}
+	}
+	if *thresholds != "" {
+		return checkThresholds(prof, *thresholds)
 	}
 	return nil
 }
 
-func outputFile(importPath, name string, fset *token.FileSet, file *ast.File) error {
+// selectFuncs applies the -exclude-func and -func flags to prof, and
+// returns the functions to keep regardless of coverage as given by -keep.
+func selectFuncs(prof *discover.Profile) (keep map[string]bool, err error) {
+	if *excludeFunc != "" {
+		re, err := regexp.Compile(*excludeFunc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -exclude-func: %v", err)
+		}
+		excludeFuncs(prof, re)
+	}
+	if *focusFunc != "" {
+		if err := focusFuncs(prof, *focusFunc); err != nil {
+			return nil, err
+		}
+		// Init functions are not called by the function, so leave them
+		// out unless asked otherwise.
+		if !flagSet("trim-init") {
+			prof.TrimInit = true
+		}
+	}
+	if *keepFile != "" {
+		if keep, err = readKeepFile(*keepFile); err != nil {
+			return nil, err
+		}
+	}
+	return keep, nil
+}
+
+// funcCounts holds the number of covered functions in a file, and the
+// number of functions in total.
+type funcCounts struct {
+	covered, total int
+}
+
+// countFuncs returns the function counts of each file of prof, which
+// must not have been trimmed yet.
+func countFuncs(prof *discover.Profile) map[*ast.File]funcCounts {
+	counts := make(map[*ast.File]funcCounts)
+	for _, f := range prof.Files {
+		var c funcCounts
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				c.total++
+				if prof.Funcs[fn] {
+					c.covered++
+				}
+			}
+		}
+		counts[f] = c
+	}
+	return counts
+}
+
+// reportProgress reports on stderr that done out of total files have been
+// processed as described by verb, updating the line of the previous report.
+// The line is ended once all files are done.
+func reportProgress(verb string, done, total int) {
+	fmt.Fprintf(os.Stderr, "\r%s %d/%d files", verb, done, total)
+	if done == total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// transformFile trims or annotates f as selected by the command-line flags,
+// and reports whether the result should be output. The functions named in
+// keep are retained by the trimming.
+func transformFile(prof *discover.Profile, f *ast.File, keep map[string]bool) bool {
+	if *annotate {
+		prof.Annotate(f)
+	} else {
+		// Skip files without any coverage without trimming them
+		if keep == nil && !prof.HasCoverage(f) {
+			return false
+		}
+		prof.TrimWithKeep(f, keep)
+		if *lineDirs {
+			prof.AddLineDirectives(f)
+		}
+	}
+
+	// If we filtered out all decls, don't print at all
+	return len(f.Decls) > 0
+}
+
+// dryRunStats summarizes, per package, what -dry-run would have output.
+type dryRunStats struct {
+	pkgs  []string
+	files map[string]int // files output
+	decls map[string]int // declarations in total
+	kept  map[string]int // declarations output
+}
+
+// add records the file f of the package with the given import path,
+// which held decls declarations before trimming.
+func (s *dryRunStats) add(importPath string, decls int, f *ast.File, emit bool) {
+	if s.decls == nil {
+		s.files = make(map[string]int)
+		s.decls = make(map[string]int)
+		s.kept = make(map[string]int)
+	}
+	if _, ok := s.decls[importPath]; !ok {
+		s.pkgs = append(s.pkgs, importPath)
+	}
+	s.decls[importPath] += decls
+	if emit {
+		s.files[importPath]++
+		s.kept[importPath] += len(f.Decls)
+	}
+}
+
+// print writes the summary of each package to w, sorted by import path.
+func (s *dryRunStats) print(w io.Writer) {
+	sort.Strings(s.pkgs)
+	for _, pkg := range s.pkgs {
+		fmt.Fprintf(w, "%s: %d files, %d of %d declarations trimmed\n",
+			pkg, s.files[pkg], s.decls[pkg]-s.kept[pkg], s.decls[pkg])
+	}
+}
+
+// readKeepFile reads the function names listed in the file with the given
+// name, one per line. Blank lines and lines starting with "#" are ignored.
+func readKeepFile(name string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			keep[line] = true
+		}
+	}
+	return keep, nil
+}
+
+// reprint parses src and prints it again using cfg.
+func reprint(cfg *printer.Config, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := cfg.Fprint(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sourceDir returns the path of dir relative to the root of its module,
+// or importPath if dir is not within a module.
+func sourceDir(dir, importPath string) string {
+	for root := dir; ; {
+		if _, err := os.Stat(filepath.Join(root, "go.mod")); err == nil {
+			if rel, err := filepath.Rel(root, dir); err == nil {
+				return rel
+			}
+			return importPath
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return importPath
+		}
+		root = parent
+	}
+}
+
+// excludeFuncs excludes the functions whose name, or qualified name for
+// methods, matches re from trimming, including those that would otherwise
+// always be kept, such as init functions. The covered ones are also marked
+// as not covered, so that they are left out of the call graph.
+func excludeFuncs(prof *discover.Profile, re *regexp.Regexp) {
+	exclude := func(fn *ast.FuncDecl) bool {
+		return re.MatchString(fn.Name.Name) || re.MatchString(discover.FuncName(fn))
+	}
+	for fn := range prof.Funcs {
+		if exclude(fn) {
+			delete(prof.Funcs, fn)
+		}
+	}
+	prof.Exclude = exclude
+}
+
+// focusFuncs marks every covered function as not covered, except the
+// function with the given name and the covered functions reachable from it,
+// so that trimming keeps only those. The name may be qualified by the
+// package's import path or name. The named function is kept even if it
+// was not covered.
+func focusFuncs(prof *discover.Profile, name string) error {
+	var roots []*ast.FuncDecl
+	for _, f := range prof.Files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			qname := qualifiedName(prof, fn)
+			if qname == name || strings.HasSuffix(qname, "/"+name) || discover.FuncName(fn) == name {
+				roots = append(roots, fn)
+			}
+		}
+	}
+	if len(roots) == 0 {
+		return fmt.Errorf("no function named %q in the profile", name)
+	}
+
+	keep := prof.Reachable(roots...)
+	for fn := range prof.Funcs {
+		if !keep[fn] {
+			delete(prof.Funcs, fn)
+		}
+	}
+	for _, fn := range roots {
+		prof.Funcs[fn] = true
+	}
+	return nil
+}
+
+// flagSet reports whether the flag with the given name was set
+// on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// loadProfile parses the cover profile in fileName using the parse
+// and trim options selected by the command-line flags.
+func loadProfile(fileName string) (*discover.Profile, error) {
+	profiles, err := cover.ParseProfiles(fileName)
+	if err != nil {
+		return nil, err
+	}
+	// Without this, both cases silently produce empty output.
+	if msg := emptyProfileMessage(profiles); msg != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fileName, msg)
+	}
+	parse := discover.ParseProfileOptions
+	if *typed {
+		parse = discover.ParseProfileTyped
+	}
+	opts, err := parseOptions()
+	if err != nil {
+		return nil, err
+	}
+	prof, err := parse(profiles, opts)
+	if err != nil {
+		return nil, err
+	}
+	prof.KeepAllMethods = *keepMethods
+	prof.KeepMethodTypes = *keepTypes
+	prof.TrimInit = *trimInit
+	prof.KeepExportedSignatures = *keepExports
+	prof.KeepSpacing = *keepSpacing
+	prof.KeepErrorChecks = *keepErrors
+	prof.FieldUsage = *fieldUsage
+	if *collapse {
+		prof.Significant = prof.IsSignificant
+	}
+	prof.GuardContext = *guards
+	if *tabWidth > 0 {
+		prof.Printer = &printer.Config{Mode: printer.UseSpaces, Tabwidth: *tabWidth}
+	}
+	return prof, nil
+}
+
+// emptyProfileMessage explains why profiles would produce empty output,
+// or returns "" if they cover any statements.
+func emptyProfileMessage(profiles []*cover.Profile) string {
+	blocks := 0
+	for _, prof := range profiles {
+		for _, b := range prof.Blocks {
+			if b.Count > 0 {
+				return ""
+			}
+			blocks++
+		}
+	}
+	if blocks == 0 {
+		return "the cover profile has no blocks: either no tests ran, or the profiled packages have no coverable statements"
+	}
+	return "no statements were covered: tests ran, but did not reach the profiled packages"
+}
+
+// parseOptions returns the parse options selected by the command-line flags.
+func parseOptions() (*discover.Options, error) {
+	ctxt := build.Default
+	ctxt.BuildTags = buildTags()
+	opts := &discover.Options{
+		SkipMissing:     *skipMissing,
+		SkipParseErrors: *skipInvalid,
+		SkipTests:       *noTests,
+		Context:         &ctxt,
+	}
+	if *progress {
+		opts.Progress = func(_ string, done, total int) {
+			reportProgress("parsed", done, total)
+		}
+	}
+	if *srcRoot != "" {
+		i := strings.LastIndexByte(*srcRoot, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid -src-root %q: want prefix=dir", *srcRoot)
+		}
+		dir, err := filepath.Abs((*srcRoot)[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		opts.SrcPrefix, opts.SrcRoot = (*srcRoot)[:i], dir
+	}
+	return opts, nil
+}
+
+// buildTags returns the build tags given by the -tags flag or,
+// if it is not set, by the -tags flag in $GOFLAGS.
+func buildTags() []string {
+	list := *tags
+	if list == "" {
+		for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+			f = strings.TrimPrefix(f, "-")
+			if strings.HasPrefix(f, "-tags=") || strings.HasPrefix(f, "tags=") {
+				list = f[strings.Index(f, "=")+1:]
+			}
+		}
+	}
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// formatFile returns the source of file as selected by the
+// command-line flags.
+func formatFile(prof *discover.Profile, file *ast.File) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := prof.WriteFile(&buf, file); err != nil {
+		return nil, err
+	}
+	src := buf.Bytes()
+	if *goimports {
+		var err error
+		src, err = imports.Process(prof.Fset.File(file.Pos()).Name(), src, nil)
+		if err != nil {
+			return nil, err
+		}
+		if prof.Printer != nil {
+			// Reapply the printer settings undone by goimports
+			if src, err = reprint(prof.Printer, src); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return src, nil
+}
+
+// outputFile writes file to the -output directory, or to stdout if it is
+// not set, and returns the path of the file written, or "" for stdout.
+func outputFile(prof *discover.Profile, importPath, name string, file *ast.File) (string, error) {
+	src, err := formatFile(prof, file)
+	if err != nil {
+		return "", err
+	}
+
 	if *output != "" {
 		// Write to file
 		dir := filepath.Join(*output, importPath)
+		if *layout == "source" {
+			dir = filepath.Join(*output, sourceDir(filepath.Dir(prof.Fset.File(file.Pos()).Name()), importPath))
+		}
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			return err
+			return "", err
 		}
 		target := filepath.Join(dir, name)
-		f, err := os.Create(target)
-		if err != nil {
-			return err
-		}
-		if err := format.Node(f, fset, file); err != nil {
-			return err
-		}
-		return nil
+		return target, ioutil.WriteFile(target, src, 0644)
 	}
 
 	// Print to stdout
 	fmt.Printf("%s:\n%s\n", name, strings.Repeat("=", len(name)))
-	format.Node(os.Stdout, fset, file)
+	os.Stdout.Write(src)
 	fmt.Printf("\n\n")
-	return nil
+	return "", nil
 }
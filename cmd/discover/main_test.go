@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestReadKeepFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "keep.txt")
+	data := "# Always show these\nFoo\n\n  Server.ServeHTTP  \n"
+	if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keep, err := readKeepFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"Foo": true, "Server.ServeHTTP": true}
+	if !reflect.DeepEqual(keep, want) {
+		t.Errorf("readKeepFile = %v, want %v", keep, want)
+	}
+}
+
+func TestEmptyProfileMessage(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"NoBlocks", "mode: set\n", "no tests ran"},
+		{"Uncovered", "mode: set\nexample.com/p/p.go:3.14,5.2 1 0\nexample.com/p/p.go:7.14,9.2 2 0\n", "did not reach"},
+		{"Covered", "mode: set\nexample.com/p/p.go:3.14,5.2 1 0\nexample.com/p/p.go:7.14,9.2 2 1\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "cover.out")
+			if err := ioutil.WriteFile(name, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			profiles, err := cover.ParseProfiles(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := emptyProfileMessage(profiles)
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("emptyProfileMessage = %q, want it to mention %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// trimProfile is the cover profile of the trim package in testdata.
+var trimProfile = filepath.Join("..", "..", "testdata", "trim", "cover.out")
+
+func TestParseProfileManifestCounts(t *testing.T) {
+	prof, err := loadProfile(trimProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := countFuncs(prof)[prof.Files[0]]
+	if want.covered == 0 || want.covered == want.total {
+		t.Fatalf("trim.go has %d of %d functions covered; want some but not all", want.covered, want.total)
+	}
+
+	for _, tt := range []struct{ excludeFunc, focusFunc string }{
+		{"", ""},
+		{"^Covered$", ""},
+		{"", "Covered"},
+	} {
+		dir := t.TempDir()
+		func() {
+			defer func(out, exclude, focus string) {
+				*output, *excludeFunc, *focusFunc = out, exclude, focus
+			}(*output, *excludeFunc, *focusFunc)
+			*output, *excludeFunc, *focusFunc = dir, tt.excludeFunc, tt.focusFunc
+			if err := parseProfile(context.Background(), trimProfile); err != nil {
+				t.Fatal(err)
+			}
+		}()
+
+		// The counts are those of the original file, whichever
+		// functions were selected for the output.
+		m := readManifest(t, dir)
+		if len(m.Files) != 1 {
+			t.Fatalf("manifest lists %d files, want 1", len(m.Files))
+		}
+		if got := m.Files[0]; got.CoveredFuncs != want.covered || got.TotalFuncs != want.total {
+			t.Errorf("-exclude-func=%q -func=%q: manifest counts %d of %d functions covered, want %d of %d",
+				tt.excludeFunc, tt.focusFunc, got.CoveredFuncs, got.TotalFuncs, want.covered, want.total)
+		}
+	}
+}
+
+// readManifest reads the manifest of the output directory dir.
+func readManifest(t *testing.T, dir string) manifest {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestDryRunStats(t *testing.T) {
+	decls := func(n int) *ast.File {
+		return &ast.File{Decls: make([]ast.Decl, n)}
+	}
+	var s dryRunStats
+	s.add("example.com/b", 4, decls(1), true)
+	s.add("example.com/a", 3, decls(0), false) // nothing covered
+	s.add("example.com/b", 5, decls(2), true)
+	s.add("example.com/a", 2, decls(2), true)
+
+	var buf bytes.Buffer
+	s.print(&buf)
+	want := `example.com/a: 1 files, 3 of 5 declarations trimmed
+example.com/b: 2 files, 6 of 9 declarations trimmed
+`
+	if got := buf.String(); got != want {
+		t.Errorf("dry run summary:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseProfileDryRun(t *testing.T) {
+	dir := t.TempDir()
+	defer func(out string, dry bool) {
+		*output, *dryRun = out, dry
+	}(*output, *dryRun)
+	*output, *dryRun = dir, true
+
+	if err := parseProfile(context.Background(), trimProfile); err != nil {
+		t.Fatal(err)
+	}
+	// Neither the trimmed files nor the manifest are written.
+	if names, err := ioutil.ReadDir(dir); err != nil || len(names) != 0 {
+		t.Errorf("-dry-run wrote %d files to -output (%v)", len(names), err)
+	}
+}
+
+func TestSourceDir(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir, want string
+	}{
+		{root, "."},
+		{filepath.Join(root, "a", "b"), filepath.Join("a", "b")},
+		// Outside of a module, the import path is used.
+		{filepath.Dir(root), "example.com/p"},
+	}
+	for _, tt := range tests {
+		if got := sourceDir(tt.dir, "example.com/p"); got != tt.want {
+			t.Errorf("sourceDir(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestParseProfileSourceLayout(t *testing.T) {
+	dir := t.TempDir()
+	defer func(out, lay string) {
+		*output, *layout = out, lay
+	}(*output, *layout)
+	*output, *layout = dir, "source"
+
+	if err := parseProfile(context.Background(), trimProfile); err != nil {
+		t.Fatal(err)
+	}
+	// The file is written by its directory within this module, rather
+	// than by its import path.
+	want := "testdata/trim/trim.go"
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(want))); err != nil {
+		t.Error(err)
+	}
+	if m := readManifest(t, dir); len(m.Files) != 1 || m.Files[0].Path != want {
+		t.Errorf("manifest lists %+v, want only %s", m.Files, want)
+	}
+}
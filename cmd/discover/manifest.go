@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestName is the name of the manifest file in the -output directory.
+const manifestName = "manifest.json"
+
+// manifest lists the files written to an output directory.
+type manifest struct {
+	Files []manifestFile `json:"files"`
+}
+
+// manifestFile describes a single file in a manifest.
+type manifestFile struct {
+	Path         string `json:"path"`         // slash-separated, relative to the output directory
+	ImportPath   string `json:"importPath"`   // import path of the package
+	Source       string `json:"source"`       // path of the original source file
+	CoveredFuncs int    `json:"coveredFuncs"` // functions covered in the original file
+	TotalFuncs   int    `json:"totalFuncs"`   // functions in the original file
+}
+
+// writeManifest writes the manifest of the output directory dir, listing
+// the files just written. If sync is set, the files listed in the previous
+// manifest that are not among those just written are removed first.
+func writeManifest(dir string, written []manifestFile, sync bool) error {
+	manifestPath := filepath.Join(dir, manifestName)
+	m := manifest{Files: written}
+	if sync {
+		if err := removeStale(dir, manifestPath, written); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(manifestPath, append(data, '\n'), 0644)
+}
+
+// removeStale removes the files listed in the manifest at manifestPath
+// that are not among the files just written to dir.
+func removeStale(dir, manifestPath string, written []manifestFile) error {
+	var old manifest
+	if data, err := ioutil.ReadFile(manifestPath); err == nil {
+		if err := json.Unmarshal(data, &old); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Refuse to remove anything if the manifest, which may have been
+	// edited or be from elsewhere, lists files outside of dir.
+	for _, f := range old.Files {
+		if !withinDir(f.Path) {
+			return fmt.Errorf("%s lists %q, which is not within %s", manifestPath, f.Path, dir)
+		}
+	}
+
+	keep := make(map[string]bool)
+	for _, f := range written {
+		keep[f.Path] = true
+	}
+	for _, f := range old.Files {
+		if keep[f.Path] {
+			continue
+		}
+		name := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		removeEmptyDirs(dir, filepath.Dir(name))
+	}
+	return nil
+}
+
+// withinDir reports whether the slash-separated relative path lies
+// within the directory it is relative to, rather than naming the
+// directory itself or escaping it.
+func withinDir(path string) bool {
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" {
+		return false
+	}
+	return clean != "." && clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
+
+// removeEmptyDirs removes dir and its parents up to (but excluding)
+// root, for as long as they are empty.
+func removeEmptyDirs(root, dir string) {
+	for dir != root && len(dir) > len(root) {
+		if os.Remove(dir) != nil {
+			return // not empty
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteManifestSync(t *testing.T) {
+	dir := t.TempDir()
+	write := func(names ...string) []manifestFile {
+		t.Helper()
+		var files []manifestFile
+		for _, name := range names {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte("package p\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, manifestFile{Path: name})
+		}
+		return files
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		return err == nil
+	}
+
+	// The first run has no previous manifest.
+	first := write("a/a.go", "b/c/b.go", "b/b.go")
+	if err := writeManifest(dir, first, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readManifest(t, dir).Files; !reflect.DeepEqual(got, first) {
+		t.Errorf("manifest lists %v, want %v", got, first)
+	}
+
+	// Without -sync, files no longer output are left alone.
+	if err := writeManifest(dir, write("a/a.go"), false); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("b/c/b.go") {
+		t.Error("b/c/b.go was removed without -sync")
+	}
+
+	// With it, they are removed along with the directories left empty,
+	// as listed by the manifest before the one just written.
+	if err := writeManifest(dir, first, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(dir, write("a/a.go", "b/b.go"), true); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"a/a.go": true, "b/b.go": true, "b/c/b.go": false, "b/c": false} {
+		if exists(name) != want {
+			t.Errorf("%s exists = %v, want %v", name, !want, want)
+		}
+	}
+}
+
+func TestWriteManifestSyncOutside(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "out")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	victim := filepath.Join(root, "victim.go")
+	if err := ioutil.WriteFile(victim, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"../victim.go", "a/../../victim.go", filepath.ToSlash(victim), ".", ".."} {
+		old := []manifestFile{{Path: "a.go"}, {Path: path}}
+		if err := writeManifest(dir, old, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeManifest(dir, nil, true); err == nil {
+			t.Errorf("manifest listing %q: no error", path)
+		}
+		if _, err := os.Stat(victim); err != nil {
+			t.Fatalf("manifest listing %q: %v", path, err)
+		}
+	}
+}
+
+func TestWithinDir(t *testing.T) {
+	for path, want := range map[string]bool{
+		"a.go": true, "a/b.go": true, "a/../b.go": true, "./a.go": true, "..a/b.go": true,
+		"": false, ".": false, "..": false, "../a.go": false, "a/../../b.go": false, "/a.go": false,
+	} {
+		if got := withinDir(path); got != want {
+			t.Errorf("withinDir(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
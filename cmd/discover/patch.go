@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eandre/discover"
+)
+
+// contextLines is the number of unchanged lines around each hunk.
+const contextLines = 3
+
+// printPatch prints a unified diff turning the original source of f into
+// its output, for -format=patch. If emit is false, f is not output at all,
+// so the diff deletes the file. Paths are relative to the module root, as
+// with -layout=source, so the patch applies with "patch -p1" from there.
+func printPatch(prof *discover.Profile, f *ast.File, emit bool) error {
+	name := prof.Fset.File(f.Pos()).Name()
+	orig, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var src []byte
+	if emit {
+		if src, err = formatFile(prof, f); err != nil {
+			return err
+		}
+	}
+	path := filepath.ToSlash(filepath.Join(sourceDir(filepath.Dir(name), prof.ImportPaths[f]), filepath.Base(name)))
+	return writePatch(os.Stdout, path, string(orig), string(src), !emit)
+}
+
+// diffOp is a single line of a diff: ' ' for an unchanged line,
+// '-' for a deleted line or '+' for an inserted line.
+type diffOp struct {
+	kind byte
+	line string // including its newline, if any
+}
+
+// writePatch writes a unified diff from a to b of the file with the given
+// path to w, or nothing if they are equal. If deleted is set, the diff
+// deletes the file.
+func writePatch(w io.Writer, path, a, b string, deleted bool) error {
+	ops := diffLines(splitLines(a), splitLines(b))
+	to := "b/" + path
+	if deleted {
+		to = "/dev/null"
+	}
+	header := fmt.Sprintf("--- a/%s\n+++ %s\n", path, to)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk over changes separated by little enough
+		// context to share it.
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].kind == ' ' {
+				run++
+			}
+			if end+run == len(ops) || run > 2*contextLines {
+				if run > contextLines {
+					run = contextLines
+				}
+				end += run
+				break
+			}
+			end += run
+		}
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+
+		if header != "" {
+			if _, err := io.WriteString(w, header); err != nil {
+				return err
+			}
+			header = ""
+		}
+		if err := writeHunk(w, ops, start, end); err != nil {
+			return err
+		}
+		i = end
+	}
+	return nil
+}
+
+// writeHunk writes the hunk of ops[start:end] to w.
+func writeHunk(w io.Writer, ops []diffOp, start, end int) error {
+	var aLine, bLine, aLen, bLen int
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			aLine++
+		}
+		if op.kind != '-' {
+			bLine++
+		}
+	}
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			aLen++
+		}
+		if op.kind != '-' {
+			bLen++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aLine, aLen), hunkRange(bLine, bLen))
+	for _, op := range ops[start:end] {
+		sb.WriteByte(op.kind)
+		sb.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// hunkRange formats the range of a hunk starting after the given number
+// of lines, as in "3,4". An empty range names the line before it.
+func hunkRange(before, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprint(before + 1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, n)
+}
+
+// splitLines splits s into lines, keeping their newlines.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns a shortest edit script turning a into b, computed
+// with Myers' linear-space algorithm.
+func diffLines(a, b []string) []diffOp {
+	d := &differ{a: a, b: b, deleted: make([]bool, len(a)), inserted: make([]bool, len(b))}
+	d.compare(0, len(a), 0, len(b))
+
+	var ops []diffOp
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		case j < len(b) && d.inserted[j]:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		default:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		}
+	}
+	return ops
+}
+
+// differ marks the lines deleted from a and inserted into b.
+type differ struct {
+	a, b              []string
+	deleted, inserted []bool
+}
+
+// compare marks the differences between a[aLo:aHi] and b[bLo:bHi].
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	if aLo == aHi || bLo == bHi {
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+		return
+	}
+	x, y, ok := d.bisect(aLo, aHi, bLo, bHi)
+	if !ok {
+		d.compare(aLo, aHi, bLo, bLo) // delete all of a
+		d.compare(aHi, aHi, bLo, bHi) // insert all of b
+		return
+	}
+	d.compare(aLo, x, bLo, y)
+	d.compare(x, aHi, y, bHi)
+}
+
+// bisect finds the middle snake of an optimal edit path between
+// a[aLo:aHi] and b[bLo:bHi], searching forward and backward at once,
+// and returns the point (x, y) at which to split the problem.
+func (d *differ) bisect(aLo, aHi, bLo, bHi int) (x, y int, ok bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	off := maxD
+	vf := make([]int, 2*maxD+2) // furthest x on each forward diagonal
+	vb := make([]int, 2*maxD+2) // furthest x on each backward diagonal
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[off+1], vb[off+1] = 0, 0
+	delta := n - m
+	front := delta%2 != 0 // whether the forward path closes the overlap
+
+	var fStart, fEnd, bStart, bEnd int
+	for D := 0; D < maxD; D++ {
+		for k := -D + fStart; k <= D-fEnd; k += 2 {
+			var x1 int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x1 = vf[off+k+1]
+			} else {
+				x1 = vf[off+k-1] + 1
+			}
+			y1 := x1 - k
+			for x1 < n && y1 < m && d.a[aLo+x1] == d.b[bLo+y1] {
+				x1++
+				y1++
+			}
+			vf[off+k] = x1
+			switch {
+			case x1 > n:
+				fEnd += 2 // ran off the right
+			case y1 > m:
+				fStart += 2 // ran off the bottom
+			case front:
+				if kb := off + delta - k; kb >= 0 && kb < len(vb) && vb[kb] != -1 {
+					if x1 >= n-vb[kb] {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+		for k := -D + bStart; k <= D-bEnd; k += 2 {
+			var x2 int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				x2 = vb[off+k+1]
+			} else {
+				x2 = vb[off+k-1] + 1
+			}
+			y2 := x2 - k
+			for x2 < n && y2 < m && d.a[aHi-x2-1] == d.b[bHi-y2-1] {
+				x2++
+				y2++
+			}
+			vb[off+k] = x2
+			switch {
+			case x2 > n:
+				bEnd += 2
+			case y2 > m:
+				bStart += 2
+			case !front:
+				if kf := off + delta - k; kf >= 0 && kf < len(vf) && vf[kf] != -1 {
+					x1 := vf[kf]
+					y1 := off + x1 - kf
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
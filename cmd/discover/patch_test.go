@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePatch(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+	src := strings.Join(lines, "")
+	// edit returns src with the given lines, numbered from 1, replaced.
+	edit := func(repl map[int]string) string {
+		var sb strings.Builder
+		for i, line := range lines {
+			if r, ok := repl[i+1]; ok {
+				line = r
+			}
+			sb.WriteString(line)
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		deleted bool
+		want    string // the output, if not only checked by applying it
+		hunks   int    // the number of hunks, if checked
+	}{
+		{name: "Empty", a: src, b: src, want: ""},
+		{name: "Change", a: "a\nb\nc\n", b: "a\nB\nc\n", want: `--- a/x.go
++++ b/x.go
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`},
+		{name: "SeparateHunks", a: src, b: edit(map[int]string{3: "three\n", 17: ""}), hunks: 2},
+		{name: "SharedHunk", a: src, b: edit(map[int]string{6: "", 11: "eleven\nand a half\n"}), hunks: 1},
+		{name: "Insert", a: "", b: "a\nb\n", want: `--- a/x.go
++++ b/x.go
+@@ -0,0 +1,2 @@
++a
++b
+`},
+		{name: "NoNewlineRemoved", a: "a\nb", b: "a\nb\n", want: `--- a/x.go
++++ b/x.go
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`},
+		{name: "NoNewlineAdded", a: "a\nb\n", b: "a\nc"},
+		{name: "Delete", a: "a\nb\n", b: "", deleted: true, want: `--- a/x.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-a
+-b
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writePatch(&buf, "x.go", tt.a, tt.b, tt.deleted); err != nil {
+				t.Fatal(err)
+			}
+			patch := buf.String()
+			if tt.want != "" || tt.a == tt.b {
+				if patch != tt.want {
+					t.Errorf("patch:\n%s\nwant:\n%s", patch, tt.want)
+				}
+			}
+			if n := strings.Count(patch, "\n@@ "); tt.hunks != 0 && n != tt.hunks {
+				t.Errorf("patch has %d hunks, want %d:\n%s", n, tt.hunks, patch)
+			}
+			if tt.a == tt.b {
+				return
+			}
+			got, err := applyPatch(tt.a, patch)
+			if err != nil {
+				t.Fatalf("%v in patch:\n%s", err, patch)
+			}
+			if got != tt.b {
+				t.Errorf("applying the patch gives:\n%q\nwant:\n%q\npatch:\n%s", got, tt.b, patch)
+			}
+		})
+	}
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rnd.Intn(30))
+		for i := range lines {
+			lines[i] = strconv.Itoa(rnd.Intn(4)) + "\n"
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		ops := diffLines(a, b)
+
+		var gotA, gotB []string
+		edits := 0
+		for _, op := range ops {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) = %v does not turn one into the other", a, b, ops)
+		}
+		if want := len(a) + len(b) - 2*lcsLen(a, b); edits != want {
+			t.Fatalf("diffLines(%q, %q) has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+// lcsLen returns the length of the longest common subsequence of a and b.
+func lcsLen(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// applyPatch applies the hunks of a unified diff of a single file to a.
+func applyPatch(a, patch string) (string, error) {
+	src := splitLines(a)
+	lines := splitLines(patch)
+
+	var out []string
+	next := 0 // index of the next line of src
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") {
+			continue
+		}
+		if strings.HasPrefix(line, "@@ ") {
+			var start, n int
+			if _, err := fmt.Sscanf(line, "@@ -%d,%d", &start, &n); err != nil {
+				if _, err := fmt.Sscanf(line, "@@ -%d", &start); err != nil {
+					return "", fmt.Errorf("bad hunk header %q", line)
+				}
+				n = 1
+			}
+			if n > 0 {
+				start-- // the range names the line before an empty hunk
+			}
+			if start < next {
+				return "", fmt.Errorf("hunk %q overlaps the previous one", line)
+			}
+			out = append(out, src[next:start]...)
+			next = start
+			continue
+		}
+		text := line[1:]
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], `\ No newline at end of file`) {
+			text = strings.TrimSuffix(text, "\n")
+			i++
+		}
+		switch line[0] {
+		case ' ', '-':
+			if next >= len(src) || src[next] != text {
+				return "", fmt.Errorf("line %d does not match %q", next+1, line)
+			}
+			next++
+			if line[0] == ' ' {
+				out = append(out, text)
+			}
+		case '+':
+			out = append(out, text)
+		default:
+			return "", fmt.Errorf("bad line %q", line)
+		}
+	}
+	out = append(out, src[next:]...)
+	return strings.Join(out, ""), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// inScope reports whether the package with the given import path should be
+// output: vendored packages are left out unless -vendor is set, and with
+// -module-only, so are packages outside the modules in modules.
+func inScope(importPath string, modules []string) bool {
+	if !*vendored && (strings.HasPrefix(importPath, "vendor/") || strings.Contains(importPath, "/vendor/")) {
+		return false
+	}
+	if modules == nil {
+		return true
+	}
+	for _, mod := range modules {
+		if importPath == mod || strings.HasPrefix(importPath, mod+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// currentModules returns the paths of the main modules, as listed by
+// "go list -m" in the current directory: the module containing it, or
+// every module of the enclosing go.work workspace.
+func currentModules(ctx context.Context) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", "list", "-m")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("-module-only requires running within a module: %s", msg)
+		}
+		return nil, err
+	}
+	modules := strings.Fields(stdout.String())
+	for _, mod := range modules {
+		// Listed by newer versions of go outside of any module.
+		if mod == "command-line-arguments" {
+			return nil, errors.New("-module-only requires running within a module")
+		}
+	}
+	return modules, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInScope(t *testing.T) {
+	defer func(v bool) { *vendored = v }(*vendored)
+	modules := []string{"example.com/m", "example.com/w"}
+	tests := []struct {
+		importPath string
+		modules    []string
+		vendor     bool
+		want       bool
+	}{
+		{"example.com/m/p", nil, false, true},
+		{"example.com/m/vendor/example.com/v", nil, false, false},
+		{"vendor/golang.org/x/net/http2", nil, false, false},
+		{"example.com/m/vendor/example.com/v", nil, true, true},
+		{"example.com/m/vendored", nil, false, true},
+
+		{"example.com/m", modules, false, true},
+		{"example.com/w/p", modules, false, true},
+		{"example.com/mod/p", modules, false, false},
+		{"golang.org/x/tools/cover", modules, false, false},
+		{"example.com/m/vendor/example.com/v", modules, true, true},
+		{"example.com/m/vendor/example.com/v", modules, false, false},
+	}
+	for _, tt := range tests {
+		*vendored = tt.vendor
+		if got := inScope(tt.importPath, tt.modules); got != tt.want {
+			t.Errorf("inScope(%q, %q) with -vendor=%v = %v, want %v",
+				tt.importPath, tt.modules, tt.vendor, got, tt.want)
+		}
+	}
+}
+
+func TestCurrentModules(t *testing.T) {
+	got, err := currentModules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"github.com/eandre/discover"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("currentModules() = %q, want %q", got, want)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := currentModules(context.Background()); err == nil || !strings.Contains(err.Error(), "-module-only") {
+		t.Errorf("currentModules() outside a module: error %v, want one mentioning -module-only", err)
+	}
+}
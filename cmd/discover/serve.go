@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eandre/discover"
+)
+
+var indexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<title>discover</title>
+<h1>discover</h1>
+{{range .}}<h2>{{.ImportPath}}</h2>
+<ul>
+{{range .Files}}<li><a href="/file/{{.Index}}">{{.Name}}</a></li>
+{{end}}</ul>
+{{end}}`))
+
+var fileTmpl = template.Must(template.New("file").Parse(`<!DOCTYPE html>
+<title>{{.Name}} - discover</title>
+<p><a href="/">All packages</a></p>
+<h1>{{.ImportPath}}/{{.Name}}</h1>
+<pre>{{.Source}}</pre>`))
+
+// server serves the trimmed files of a profile over HTTP.
+type server struct {
+	prof *discover.Profile
+	keep map[string]bool // functions to keep, as given by -keep
+
+	mu   sync.Mutex
+	srcs map[int]string // trimmed source by file index
+}
+
+// serveProfile parses the cover profile in fileName and serves
+// its trimmed files over HTTP on addr, trimmed as the parse command
+// would output them.
+func serveProfile(fileName, addr string) error {
+	prof, err := loadProfile(fileName)
+	if err != nil {
+		return err
+	}
+	keep, err := selectFuncs(prof)
+	if err != nil {
+		return err
+	}
+
+	s := &server{prof: prof, keep: keep, srcs: make(map[int]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveIndex)
+	mux.HandleFunc("/file/", s.serveFile)
+	log.Printf("serving %s on http://%s/", fileName, addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// serveIndex lists the files of the profile, grouped by package.
+func (s *server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	type file struct {
+		Index int
+		Name  string
+	}
+	type pkg struct {
+		ImportPath string
+		Files      []file
+	}
+	byPath := make(map[string]*pkg)
+	var pkgs []*pkg
+	for i, f := range s.prof.Files {
+		path := s.prof.ImportPaths[f]
+		p := byPath[path]
+		if p == nil {
+			p = &pkg{ImportPath: path}
+			byPath[path] = p
+			pkgs = append(pkgs, p)
+		}
+		p.Files = append(p.Files, file{Index: i, Name: s.fileName(f)})
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].ImportPath < pkgs[j].ImportPath })
+
+	if err := indexTmpl.Execute(w, pkgs); err != nil {
+		log.Println(err)
+	}
+}
+
+// serveFile renders a single trimmed file, given by its index in the profile.
+func (s *server) serveFile(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/file/"))
+	if err != nil || i < 0 || i >= len(s.prof.Files) {
+		http.NotFound(w, r)
+		return
+	}
+	src, err := s.source(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f := s.prof.Files[i]
+	err = fileTmpl.Execute(w, map[string]string{
+		"ImportPath": s.prof.ImportPaths[f],
+		"Name":       s.fileName(f),
+		"Source":     src,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// source returns the trimmed source of the file with index i. Since
+// trimming modifies the AST, each file is trimmed once and cached.
+func (s *server) source(i int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if src, ok := s.srcs[i]; ok {
+		return src, nil
+	}
+
+	f := s.prof.Files[i]
+	var buf bytes.Buffer
+	if transformFile(s.prof, f, s.keep) {
+		if err := s.prof.WriteFile(&buf, f); err != nil {
+			return "", err
+		}
+	} else {
+		fmt.Fprintln(&buf, "// Nothing in this file was covered.")
+	}
+	s.srcs[i] = buf.String()
+	return s.srcs[i], nil
+}
+
+func (s *server) fileName(f *ast.File) string {
+	return filepath.Base(s.prof.Fset.File(f.Pos()).Name())
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeSource(t *testing.T) {
+	keepName := filepath.Join(t.TempDir(), "keep.txt")
+	if err := ioutil.WriteFile(keepName, []byte("unused\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(exclude, keep string) {
+		*excludeFunc, *keepFile = exclude, keep
+	}(*excludeFunc, *keepFile)
+	*excludeFunc, *keepFile = "^Covered$", keepName
+
+	prof, err := loadProfile(trimProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep, err := selectFuncs(prof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{prof: prof, keep: keep, srcs: make(map[int]string)}
+	src, err := s.source(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The served file is trimmed like the parse command would output it.
+	if strings.Contains(src, "func Covered(") {
+		t.Error("function excluded by -exclude-func was served")
+	}
+	if !strings.Contains(src, "func unused(") {
+		t.Error("function listed by -keep was not served")
+	}
+}
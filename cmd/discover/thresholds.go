@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/eandre/discover"
+)
+
+// checkThresholds reads the per-package coverage thresholds from the JSON
+// file with the given name and reports the packages of prof covered less
+// than required. The file holds an object mapping import paths to minimum
+// coverage percentages; the key "*" sets the default for other packages.
+func checkThresholds(prof *discover.Profile, fileName string) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	var thresholds map[string]float64
+	if err := json.Unmarshal(data, &thresholds); err != nil {
+		return fmt.Errorf("invalid thresholds in %s: %v", fileName, err)
+	}
+
+	coverage := prof.PackageCoverage()
+	var pkgs []string
+	for pkg := range coverage {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	failed := 0
+	for _, pkg := range pkgs {
+		min, ok := thresholds[pkg]
+		if !ok {
+			if min, ok = thresholds["*"]; !ok {
+				continue
+			}
+		}
+		if coverage[pkg] < min {
+			fmt.Fprintf(os.Stderr, "%s: coverage %.1f%% is below the threshold of %.1f%%\n", pkg, coverage[pkg], min)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d packages below their coverage threshold", failed)
+	}
+	return nil
+}
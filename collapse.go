@@ -0,0 +1,109 @@
+package discover
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// IsSignificant reports whether stmt is structurally significant: whether
+// it affects control flow, contains a function literal, or calls a covered
+// function. It is the default criterion for p.Significant.
+//
+// Calls are resolved textually by the name of the called function, like
+// in CallGraph, so a call of a method matches any covered method of that
+// name.
+func (p *Profile) IsSignificant(stmt ast.Stmt) bool {
+	switch stmt.(type) {
+	case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt,
+		*ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt,
+		*ast.LabeledStmt, *ast.BranchStmt, *ast.ReturnStmt,
+		*ast.GoStmt, *ast.DeferStmt:
+		return true
+	}
+
+	significant := false
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			significant = true
+		case *ast.CallExpr:
+			name := calleeName(n.Fun)
+			if i := strings.LastIndexByte(name, '.'); i >= 0 {
+				name = name[i+1:]
+			}
+			if name != "" && p.coveredName(name) {
+				significant = true
+			}
+		}
+		return !significant
+	})
+	return significant
+}
+
+// coveredName reports whether a covered function or method has the name.
+func (p *Profile) coveredName(name string) bool {
+	for fn, covered := range p.Funcs {
+		if covered && fn.Name.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// collapse replaces each run of at least two consecutive insignificant
+// statements in the statement lists of f with a single comment, and
+// returns the comments to add once f has been trimmed. The clauses of
+// switch and select statements are never collapsed, whatever
+// p.Significant says, since the comment cannot stand in for them.
+func (p *Profile) collapse(f *ast.File) []*ast.CommentGroup {
+	var groups []*ast.CommentGroup
+	fix := func(list []ast.Stmt) []ast.Stmt {
+		var fixed, run []ast.Stmt
+		flush := func() {
+			if len(run) < 2 {
+				fixed = append(fixed, run...)
+			} else {
+				groups = append(groups, &ast.CommentGroup{
+					List: []*ast.Comment{{
+						Slash: run[0].Pos(),
+						Text:  fmt.Sprintf("// ... %d statements", len(run)),
+					}},
+				})
+			}
+			run = nil
+		}
+		for _, stmt := range list {
+			if isClause(stmt) || p.Significant(stmt) {
+				flush()
+				fixed = append(fixed, stmt)
+			} else {
+				run = append(run, stmt)
+			}
+		}
+		flush()
+		return fixed
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			n.List = fix(n.List)
+		case *ast.CaseClause:
+			n.Body = fix(n.Body)
+		case *ast.CommClause:
+			n.Body = fix(n.Body)
+		}
+		return true
+	})
+	return groups
+}
+
+// isClause reports whether stmt is a clause of a switch or select statement.
+func isClause(stmt ast.Stmt) bool {
+	switch stmt.(type) {
+	case *ast.CaseClause, *ast.CommClause:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package discover
+
+import (
+	"go/ast"
+	"path/filepath"
+	"strconv"
+)
+
+// Diff compares the covered functions of p with those of other, which
+// should be a profile of the same code base. It returns the functions
+// covered by other but not by p (as declared in other), and the functions
+// covered by p but not by other (as declared in p), each in source order.
+//
+// Since the two profiles have separate ASTs, functions are matched by
+// their import path, file name and qualified name (see FuncName).
+// Functions that share a name within a file, such as multiple init
+// functions, are further matched by their order of declaration.
+func (p *Profile) Diff(other *Profile) (added, removed []*ast.FuncDecl) {
+	oldKeys := p.coveredFuncKeys()
+	newKeys := other.coveredFuncKeys()
+	old := make(map[string]bool, len(oldKeys))
+	for _, key := range oldKeys {
+		old[key] = true
+	}
+	cur := make(map[string]bool, len(newKeys))
+	for _, key := range newKeys {
+		cur[key] = true
+	}
+
+	for _, fn := range other.coveredFuncs() {
+		if !old[newKeys[fn]] {
+			added = append(added, fn)
+		}
+	}
+	for _, fn := range p.coveredFuncs() {
+		if !cur[oldKeys[fn]] {
+			removed = append(removed, fn)
+		}
+	}
+	return added, removed
+}
+
+// coveredFuncKeys returns, for each covered function in p, a key that
+// identifies it independently of the AST it belongs to.
+func (p *Profile) coveredFuncKeys() map[*ast.FuncDecl]string {
+	keys := make(map[*ast.FuncDecl]string)
+	for _, f := range p.Files {
+		prefix := p.ImportPaths[f] + "/" + filepath.Base(p.Fset.File(f.Pos()).Name()) + ":"
+		seen := make(map[string]int)
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := FuncName(fn)
+			n := seen[name]
+			seen[name]++
+			if p.Funcs[fn] {
+				keys[fn] = prefix + name + "#" + strconv.Itoa(n)
+			}
+		}
+	}
+	return keys
+}
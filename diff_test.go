@@ -0,0 +1,41 @@
+package discover
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	// Two runs of the same code, each missing a function the other
+	// covered.
+	old := loadTestdata(t, "trim")
+	delete(old.Funcs, funcDecl(testFile(t, old, "trim.go"), "Covered"))
+	cur := loadTestdata(t, "trim")
+	curFile := testFile(t, cur, "trim.go")
+	delete(cur.Funcs, funcDecl(curFile, "helper"))
+	delete(cur.Funcs, funcDecl(curFile, "Counter.Inc"))
+
+	added, removed := old.Diff(cur)
+	names := func(fns []*ast.FuncDecl) []string {
+		var names []string
+		for _, fn := range fns {
+			names = append(names, FuncName(fn))
+		}
+		return names
+	}
+	if got, want := names(added), []string{"Covered"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("added = %v, want %v", got, want)
+	}
+	if got, want := names(removed), []string{"helper", "Counter.Inc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("removed = %v, want %v", got, want)
+	}
+
+	// The functions are those of the profile they are covered by.
+	if len(added) > 0 && added[0] != funcDecl(curFile, "Covered") {
+		t.Error("added function is not declared in the other profile")
+	}
+	if added, removed := old.Diff(old.Clone()); len(added)+len(removed) != 0 {
+		t.Errorf("Diff of a clone = %v, %v; want no differences", names(added), names(removed))
+	}
+}
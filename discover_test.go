@@ -0,0 +1,150 @@
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+// testProfiles caches the profiles parsed by loadTestdata.
+var testProfiles = struct {
+	sync.Mutex
+	m map[string]*Profile
+}{m: make(map[string]*Profile)}
+
+// loadTestdata returns the profile of the package in testdata/name, as
+// written to testdata/name/cover.out by
+//
+//	go test -coverprofile=testdata/name/cover.out ./testdata/name
+//
+// Each call returns a clone of the profile, which may be trimmed freely.
+func loadTestdata(t testing.TB, name string) *Profile {
+	t.Helper()
+	testProfiles.Lock()
+	defer testProfiles.Unlock()
+	p, ok := testProfiles.m[name]
+	if !ok {
+		profs, err := cover.ParseProfiles(filepath.Join("testdata", name, "cover.out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p, err = ParseProfile(profs); err != nil {
+			t.Fatal(err)
+		}
+		testProfiles.m[name] = p
+	}
+	return p.Clone()
+}
+
+// testFile returns the file of p with the given base name.
+func testFile(t testing.TB, p *Profile, name string) *ast.File {
+	t.Helper()
+	for _, f := range p.Files {
+		if filepath.Base(p.Fset.File(f.Pos()).Name()) == name {
+			return f
+		}
+	}
+	t.Fatalf("no file %s in profile", name)
+	return nil
+}
+
+// funcDecl returns the declaration of the function in f with the given
+// name as returned by FuncName, or nil if there is none.
+func funcDecl(f *ast.File, name string) *ast.FuncDecl {
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && FuncName(fn) == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// printFunc returns the formatted source of the function in f with the
+// given name, including its comments, or "" if there is none.
+func printFunc(t testing.TB, p *Profile, f *ast.File, name string) string {
+	t.Helper()
+	fn := funcDecl(f, name)
+	if fn == nil {
+		return ""
+	}
+	start := fn.Pos()
+	if fn.Doc != nil {
+		start = fn.Doc.Pos()
+	}
+	var comments []*ast.CommentGroup
+	for _, cg := range f.Comments {
+		if cg.Pos() >= start && cg.Pos() < fn.End() {
+			comments = append(comments, cg)
+		}
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, p.Fset, &printer.CommentedNode{Node: fn, Comments: comments}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// checkFunc checks that the function in f with the given name prints as
+// want, ignoring leading and trailing white space. An empty want checks
+// that there is no such function.
+func checkFunc(t testing.TB, p *Profile, f *ast.File, name, want string) {
+	t.Helper()
+	got := printFunc(t, p, f, name)
+	if strings.TrimSpace(got) != strings.TrimSpace(want) {
+		t.Errorf("%s:\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// syntheticProfile writes a package of n functions to a module in a
+// temporary directory, and returns a cover profile for it in which every
+// block has the given count.
+func syntheticProfile(tb testing.TB, n, count int) *cover.Profile {
+	tb.Helper()
+	dir := tb.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/synthetic\n"), 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("package synthetic\n")
+	prof := &cover.Profile{FileName: filepath.Join(dir, "synthetic.go"), Mode: "set"}
+	block := func(startLine, startCol, endLine, endCol, stmts int) {
+		prof.Blocks = append(prof.Blocks, cover.ProfileBlock{
+			StartLine: startLine, StartCol: startCol,
+			EndLine: endLine, EndCol: endCol,
+			NumStmt: stmts, Count: count,
+		})
+	}
+	for i := 0; i < n; i++ {
+		line := 3 + 9*i // line of the func keyword
+		fmt.Fprintf(&buf, `
+func f%d(x int) int {
+	if x > 0 {
+		x++
+	}
+	for i := 0; i < x; i++ {
+		x--
+	}
+	return x
+}`, i)
+		block(line+1, 2, line+1, 11, 1)
+		block(line+2, 3, line+2, 6, 1)
+		block(line+4, 2, line+4, 26, 1)
+		block(line+5, 3, line+5, 6, 1)
+		block(line+7, 2, line+7, 10, 1)
+	}
+	buf.WriteString("\n")
+	if err := ioutil.WriteFile(prof.FileName, buf.Bytes(), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return prof
+}
@@ -0,0 +1,145 @@
+package discover
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+// ToCoverProfile writes the statement coverage of p to w as a cover profile
+// in "mode: set" format, as read by golang.org/x/tools/cover and
+// "go tool cover". Only simple statements (those not containing other
+// statements) are written, one block per statement, each covered if it is
+// present in p.Stmts. Statements nested within an already written statement,
+// such as those in a function literal, are omitted to keep the blocks
+// from overlapping.
+func (p *Profile) ToCoverProfile(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "mode: set")
+	for _, f := range p.Files {
+		info := p.files[f]
+		if info == nil {
+			continue
+		}
+		for _, s := range simpleStmts(info.stmts) {
+			count := 0
+			if p.Stmts[s.stmt] {
+				count = 1
+			}
+			fmt.Fprintf(bw, "%s:%d.%d,%d.%d 1 %d\n", info.name,
+				s.startLine, s.startCol, s.endLine, s.endCol, count)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteLCOV writes the coverage of p to w in the LCOV tracefile format,
+// as read by genhtml and most coverage dashboards. For each file, an FN
+// and FNDA record is written per function, with a hit count of 1 if it
+// is in p.Funcs, and a DA record per line starting a simple statement,
+// with a hit count of 1 if any statement starting on it is in p.Stmts.
+// Source files are named by the paths they were parsed from.
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range p.Files {
+		info := p.files[f]
+		if info == nil {
+			continue
+		}
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", p.Fset.File(f.Pos()).Name())
+
+		hit := 0
+		for _, fe := range info.funcs {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fe.startLine, FuncName(fe.decl))
+		}
+		for _, fe := range info.funcs {
+			count := 0
+			if p.Funcs[fe.decl] {
+				count = 1
+				hit++
+			}
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", count, FuncName(fe.decl))
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", len(info.funcs), hit)
+
+		var lines []int
+		counts := make(map[int]int)
+		for _, s := range simpleStmts(info.stmts) {
+			if _, ok := counts[s.startLine]; !ok {
+				lines = append(lines, s.startLine)
+				counts[s.startLine] = 0
+			}
+			if p.Stmts[s.stmt] {
+				counts[s.startLine] = 1
+			}
+		}
+		hit = 0
+		for _, line := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, counts[line])
+			hit += counts[line]
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	return bw.Flush()
+}
+
+// WriteFolded writes the covered functions to w as folded stacks, the
+// input format of flamegraph.pl, weighting each function by the number
+// of times it was entered. The weights are only meaningful for profiles
+// in "count" or "atomic" mode; in "set" mode every function counts once.
+//
+// Each function appears once, on the shortest path of the call graph from
+// an entry point as determined by OrderByDepth, so that the width of a
+// frame is the weight of the function plus that of the functions below
+// it. Frames are named by import path and FuncName, as in
+// "example.com/pkg.Profile.Trim".
+func (p *Profile) WriteFolded(w io.Writer) error {
+	names := make(map[*ast.FuncDecl]string)
+	for _, f := range p.Files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				names[fn] = p.ImportPaths[f] + "." + FuncName(fn)
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	order, caller := p.depthTree()
+	for _, fn := range order {
+		stack := names[fn]
+		for c := caller[fn]; c != nil; c = caller[c] {
+			stack = names[c] + ";" + stack
+		}
+		fmt.Fprintf(bw, "%s %d\n", stack, p.hits[fn])
+	}
+	return bw.Flush()
+}
+
+// simpleStmts returns the simple statements among stmts, leaving out
+// those nested within another simple statement (in a function literal).
+func simpleStmts(stmts []*stmtExtent) []*stmtExtent {
+	var simple []*stmtExtent
+	for _, s := range stmts {
+		if !isSimpleStmt(s.stmt) {
+			continue
+		}
+		if n := len(simple); n > 0 && simple[n-1].contains(s) {
+			continue
+		}
+		simple = append(simple, s)
+	}
+	return simple
+}
+
+// isSimpleStmt reports whether s is a simple statement, that is one that
+// does not itself contain a list of statements.
+func isSimpleStmt(s ast.Stmt) bool {
+	switch s.(type) {
+	case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt,
+		*ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt,
+		*ast.CaseClause, *ast.CommClause, *ast.LabeledStmt:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package discover
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestWriteLCOV(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	var buf bytes.Buffer
+	if err := p.WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Source files are named by absolute path, which differs between
+	// checkouts.
+	dir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := bytes.ReplaceAll(buf.Bytes(), []byte("SF:"+dir+string(filepath.Separator)), []byte("SF:"))
+	got = bytes.ReplaceAll(got, []byte(string(filepath.Separator)), []byte("/"))
+
+	golden := filepath.Join("testdata", "trim.lcov")
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("WriteLCOV output differs from %s; run go test -update to update it:\n%s", golden, got)
+	}
+}
+
+func TestToCoverProfile(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	var buf bytes.Buffer
+	if err := p.ToCoverProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "cover.out")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profs, err := cover.ParseProfiles(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profs) != 1 || profs[0].FileName != testdataPath+"/trim/trim.go" || profs[0].Mode != "set" {
+		t.Fatalf("written profile is not a set mode profile of trim.go:\n%s", buf.Bytes())
+	}
+
+	// Reading the written profile back gives the same coverage of the
+	// simple statements, and so writes the same profile again.
+	rp, err := ParseProfile(profs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := rp.ToCoverProfile(&again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != buf.String() {
+		t.Errorf("profile written after reading it back:\n%s\nwant:\n%s", again.Bytes(), buf.Bytes())
+	}
+	if u := rp.Unmatched(); len(u) != 0 {
+		t.Errorf("unmatched blocks in the written profile: %v", u)
+	}
+	f := testFile(t, rp, "trim.go")
+	for name, want := range map[string]bool{"Covered": true, "helper": true, "unused": false, "Exported": false} {
+		if got := rp.Funcs[funcDecl(f, name)]; got != want {
+			t.Errorf("%s covered = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	profs, err := cover.ParseProfiles(filepath.Join("testdata", "calls", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Turn the profile into a count mode one, with the number of times
+	// ping(2) enters ping and pong, and c called by both a and b.
+	counts := map[int]int{22: 2, 40: 3, 41: 2, 43: 2, 47: 2}
+	profs[0].Mode = "count"
+	for i, b := range profs[0].Blocks {
+		if n, ok := counts[b.StartLine]; ok {
+			profs[0].Blocks[i].Count = n
+		}
+	}
+	p, err := ParseProfile(profs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := p.WriteFolded(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// c is reached through a first, and the cycle of ping and pong is
+	// entered at ping. The uncovered function unused is left out.
+	pkg := testdataPath + "/calls."
+	want := strings.NewReplacer("pkg.", pkg).Replace(`pkg.Run 1
+pkg.Run;pkg.a 1
+pkg.Run;pkg.b 1
+pkg.Run;pkg.a;pkg.c 2
+pkg.Run;pkg.b;pkg.S.M 1
+pkg.ping 3
+pkg.ping;pkg.pong 2
+`)
+	if got := buf.String(); got != want {
+		t.Errorf("WriteFolded output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+package discover
+
+import "go/ast"
+
+// StmtCoverage describes the coverage of a single statement along with its
+// extent in the original source. Lines and columns are 1-based, and the
+// end position is just past the statement, as in the cover profiles.
+type StmtCoverage struct {
+	Stmt      ast.Stmt
+	Covered   bool
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+}
+
+// Extents returns the coverage of every statement in the parsed files, in
+// file order and in source order within each file. Statements nest, so the
+// extent of a block statement contains those of the statements within it.
+//
+// The positions ignore //line directives, and are computed when the files
+// are parsed, so they remain valid after the files have been trimmed.
+func (p *Profile) Extents() []StmtCoverage {
+	var extents []StmtCoverage
+	for _, f := range p.Files {
+		info := p.files[f]
+		if info == nil {
+			continue
+		}
+		for _, se := range info.stmts {
+			extents = append(extents, StmtCoverage{
+				Stmt:      se.stmt,
+				Covered:   p.Stmts[se.stmt],
+				StartLine: se.startLine,
+				StartCol:  se.startCol,
+				EndLine:   se.endLine,
+				EndCol:    se.endCol,
+			})
+		}
+	}
+	return extents
+}
@@ -0,0 +1,239 @@
+package discover
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// pkgUsage is what covered code uses of the declarations of a package,
+// as found before any of its files were trimmed. Trimming, and collapsing
+// in particular, removes code from the files, so that looking at the
+// trimmed files would make the result depend on the order of trimming.
+type pkgUsage struct {
+	// fields holds the struct types declared in the package along
+	// with the names of their fields accessed by covered code, when
+	// p.FieldUsage is set.
+	fields map[*ast.TypeSpec][]string
+
+	// methodTypes holds the names of the receiver types in the package
+	// with covered methods.
+	methodTypes map[string]bool
+}
+
+// packageUsage returns the usage of the declarations of the package with
+// the given import path. It is computed when Trim first trims a file of
+// the package, and kept for trimming the others.
+func (p *Profile) packageUsage(importPath string) *pkgUsage {
+	u := p.usage[importPath]
+	if u == nil {
+		u = &pkgUsage{methodTypes: p.coveredMethodTypes(importPath)}
+	}
+	if p.FieldUsage && u.fields == nil {
+		u.fields = p.fieldUsage(importPath)
+	}
+	return u
+}
+
+// recordUsage records the usage of the declarations of the package of f,
+// before f is trimmed.
+func (p *Profile) recordUsage(f *ast.File) *pkgUsage {
+	importPath := p.ImportPaths[f]
+	u := p.packageUsage(importPath)
+	if p.usage == nil {
+		p.usage = make(map[string]*pkgUsage)
+	}
+	p.usage[importPath] = u
+	return u
+}
+
+// fieldUsage returns the struct types declared in the package with the
+// given import path along with the names of their fields accessed by the
+// reached code of covered functions in the package, for p.FieldUsage.
+// Types with no accessed fields are left out.
+//
+// Without type information, accesses are found textually: a selector
+// x.Field counts if x is a receiver, parameter or variable declared with
+// the struct type (or a pointer to it), and a composite literal of the
+// struct type counts its keyed fields. Shadowed variables are not told
+// apart, so the result is a best-effort approximation.
+func (p *Profile) fieldUsage(importPath string) map[*ast.TypeSpec][]string {
+	structs := make(map[string]*ast.StructType)
+	specs := make(map[string]*ast.TypeSpec)
+	for _, f := range p.Files {
+		if p.ImportPaths[f] != importPath {
+			continue
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					structs[ts.Name.Name] = st
+					specs[ts.Name.Name] = ts
+				}
+			}
+		}
+	}
+	if len(structs) == 0 {
+		return nil
+	}
+
+	used := make(map[string]map[string]bool)
+	use := func(typeName, field string) {
+		if st := structs[typeName]; st != nil && hasField(st, field) {
+			if used[typeName] == nil {
+				used[typeName] = make(map[string]bool)
+			}
+			used[typeName][field] = true
+		}
+	}
+
+	for _, file := range p.Files {
+		if p.ImportPaths[file] != importPath {
+			continue
+		}
+		vars := make(map[string]string) // variable name to struct type name
+		declare := func(fields *ast.FieldList) {
+			if fields == nil {
+				return
+			}
+			for _, field := range fields.List {
+				if name := structTypeName(field.Type); name != "" {
+					for _, id := range field.Names {
+						vars[id.Name] = name
+					}
+				}
+			}
+		}
+		p.Walk(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				vars = make(map[string]string)
+				declare(n.Recv)
+				declare(n.Type.Params)
+				declare(n.Type.Results)
+			case *ast.FuncLit:
+				declare(n.Type.Params)
+				declare(n.Type.Results)
+			case *ast.ValueSpec:
+				if name := structTypeName(n.Type); name != "" {
+					for _, id := range n.Names {
+						vars[id.Name] = name
+					}
+				}
+			case *ast.AssignStmt:
+				if n.Tok == token.DEFINE && len(n.Lhs) == len(n.Rhs) {
+					for i, lhs := range n.Lhs {
+						id, ok := lhs.(*ast.Ident)
+						if !ok {
+							continue
+						}
+						rhs := n.Rhs[i]
+						if u, ok := rhs.(*ast.UnaryExpr); ok && u.Op == token.AND {
+							rhs = u.X
+						}
+						if lit, ok := rhs.(*ast.CompositeLit); ok {
+							if name := structTypeName(lit.Type); name != "" {
+								vars[id.Name] = name
+							}
+						}
+					}
+				}
+			case *ast.CompositeLit:
+				if name := structTypeName(n.Type); name != "" {
+					for _, elt := range n.Elts {
+						if kv, ok := elt.(*ast.KeyValueExpr); ok {
+							if key, ok := kv.Key.(*ast.Ident); ok {
+								use(name, key.Name)
+							}
+						}
+					}
+				}
+			case *ast.SelectorExpr:
+				if x, ok := n.X.(*ast.Ident); ok && vars[x.Name] != "" {
+					use(vars[x.Name], n.Sel.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	usage := make(map[*ast.TypeSpec][]string, len(used))
+	for typeName, fields := range used {
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		usage[specs[typeName]] = names
+	}
+	return usage
+}
+
+// structTypeName returns the name of the type expr refers to if it is an
+// identifier, possibly behind a pointer, or "" otherwise.
+func structTypeName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// hasField reports whether st has a field with the given name,
+// including embedded fields.
+func hasField(st *ast.StructType, name string) bool {
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			typ := field.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			if sel, ok := typ.(*ast.SelectorExpr); ok {
+				typ = sel.Sel
+			}
+			if id, ok := typ.(*ast.Ident); ok && id.Name == name {
+				return true
+			}
+		}
+		for _, id := range field.Names {
+			if id.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldComments returns comments listing the fields in usage, placed
+// after the opening brace of each struct type declared in f.
+func fieldComments(f *ast.File, usage map[*ast.TypeSpec][]string) []*ast.CommentGroup {
+	var groups []*ast.CommentGroup
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok || len(usage[ts]) == 0 {
+				continue
+			}
+			st := ts.Type.(*ast.StructType)
+			groups = append(groups, &ast.CommentGroup{
+				List: []*ast.Comment{{
+					Slash: st.Fields.Opening + 1,
+					Text:  "// used: " + strings.Join(usage[ts], ", "),
+				}},
+			})
+		}
+	}
+	return groups
+}
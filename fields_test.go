@@ -0,0 +1,85 @@
+package discover
+
+import (
+	"bytes"
+	"go/ast"
+	"strings"
+	"testing"
+)
+
+// trimInOrders trims the two files of the fields testdata package in
+// either order, after calling setup on the profile, and returns the
+// resulting output of both files, which must not depend on the order.
+func trimInOrders(t *testing.T, setup func(p *Profile)) string {
+	t.Helper()
+	var outputs []string
+	for _, rev := range []bool{false, true} {
+		p := loadTestdata(t, "fields")
+		setup(p)
+		files := append([]*ast.File(nil), p.Files...)
+		if rev {
+			files[0], files[1] = files[1], files[0]
+		}
+		for _, f := range files {
+			p.Trim(f)
+		}
+
+		var buf bytes.Buffer
+		for _, f := range p.Files {
+			if err := p.WriteFile(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		outputs = append(outputs, buf.String())
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("output depends on the order of trimming:\n%s\nreversed:\n%s", outputs[0], outputs[1])
+	}
+	return outputs[0]
+}
+
+func TestTrimFieldUsage(t *testing.T) {
+	// The fields accessed by Sum are listed, even when the accesses are
+	// collapsed away before T is trimmed.
+	out := trimInOrders(t, func(p *Profile) {
+		p.FieldUsage = true
+		p.Significant = p.IsSignificant
+		for _, f := range p.Files {
+			if !p.HasCoverage(f) {
+				t.Errorf("%s has no coverage", p.Fset.File(f.Pos()).Name())
+			}
+		}
+	})
+	if !strings.Contains(out, "type T struct { // used: x, y, z") {
+		t.Errorf("fields used by Sum and Total are not listed:\n%s", out)
+	}
+}
+
+func TestTrimMethodTypesAcrossFiles(t *testing.T) {
+	setup := func(exclude bool) func(p *Profile) {
+		return func(p *Profile) {
+			p.KeepMethodTypes = true
+			p.KeepAllMethods = true
+			if exclude {
+				p.Exclude = func(fn *ast.FuncDecl) bool { return fn.Name.Name == "Total" }
+			}
+		}
+	}
+
+	// T is kept with all its methods for its covered method Total,
+	// declared in another file.
+	out := trimInOrders(t, setup(false))
+	for _, s := range []string{"type T struct", "func (t *T) Reset()"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output lacks %q:\n%s", s, out)
+		}
+	}
+
+	// With Total excluded, T has no covered methods left.
+	out = trimInOrders(t, setup(true))
+	for _, s := range []string{"type T struct", "Reset", "Total"} {
+		if strings.Contains(out, s) {
+			t.Errorf("output contains %q:\n%s", s, out)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package discover
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// AddLineDirectives inserts a //line directive before each top-level
+// declaration (including its doc comment) and each statement in a
+// statement list of f, pointing back to the corresponding line in the
+// original source file. It is intended to be called after Trim, so that
+// compiler errors and editor jumps in the trimmed output resolve to the
+// original source location.
+//
+// Nodes that do not start their line in the original source, such as
+// a statement following another on the same line, get no directive.
+// Neither do nodes at column 1 whose preceding line is in use, since
+// there is no room for the directive.
+func (p *Profile) AddLineDirectives(f *ast.File) {
+	tf := p.Fset.File(f.Pos())
+	if tf == nil {
+		return
+	}
+	first := firstOnLine(tf, f)
+	done := make(map[int]bool)
+
+	var groups []*ast.CommentGroup
+	add := func(pos token.Pos) {
+		line := rawLine(tf, pos)
+		if done[line] || first[line] != pos {
+			return
+		}
+		done[line] = true
+
+		// The directive must start at column 1 before the node. If the
+		// node itself starts at column 1, use the preceding line if free.
+		at := tf.LineStart(line)
+		if at == pos {
+			if _, used := first[line-1]; line == 1 || used {
+				return
+			}
+			at = tf.LineStart(line - 1)
+		}
+		// Point to the position the node reports, which honors any
+		// //line directives already in the original source.
+		orig := tf.PositionFor(pos, true)
+		text := "//line " + orig.Filename + ":" + strconv.Itoa(orig.Line)
+		groups = append(groups, &ast.CommentGroup{
+			List: []*ast.Comment{{Slash: at, Text: text}},
+		})
+	}
+	addList := func(list []ast.Stmt) {
+		for _, stmt := range list {
+			add(stmt.Pos())
+		}
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.File:
+			for _, decl := range n.Decls {
+				add(declStart(decl))
+			}
+		case *ast.BlockStmt:
+			addList(n.List)
+		case *ast.CaseClause:
+			addList(n.Body)
+		case *ast.CommClause:
+			addList(n.Body)
+		}
+		return true
+	})
+	addComments(f, groups)
+}
+
+// declStart returns the position of the start of decl,
+// including its doc comment.
+func declStart(decl ast.Decl) token.Pos {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			return d.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			return d.Doc.Pos()
+		}
+	}
+	return decl.Pos()
+}
+
+// rawLine returns the line of pos in tf, ignoring //line directives.
+func rawLine(tf *token.File, pos token.Pos) int {
+	return tf.PositionFor(pos, false).Line
+}
+
+// firstOnLine returns, for each line of f in tf, the position of the first
+// token on that line that is known from the AST, including its comments.
+func firstOnLine(tf *token.File, f *ast.File) map[int]token.Pos {
+	first := make(map[int]token.Pos)
+	mark := func(pos token.Pos) {
+		if !pos.IsValid() || int(pos) < tf.Base() || int(pos) > tf.Base()+tf.Size() {
+			return
+		}
+		line := rawLine(tf, pos)
+		if p, ok := first[line]; !ok || pos < p {
+			first[line] = pos
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n != nil {
+			mark(n.Pos())
+			mark(n.End() - 1)
+		}
+		return true
+	})
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			mark(c.Pos())
+		}
+	}
+	return first
+}
+
+// addComments adds the comment groups to f, keeping f.Comments
+// sorted by position.
+func addComments(f *ast.File, groups []*ast.CommentGroup) {
+	f.Comments = append(f.Comments, groups...)
+	sort.SliceStable(f.Comments, func(i, j int) bool {
+		return f.Comments[i].Pos() < f.Comments[j].Pos()
+	})
+}
@@ -0,0 +1,33 @@
+package discover
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddLineDirectivesGenerated(t *testing.T) {
+	p := loadTestdata(t, "linedir")
+	f := testFile(t, p, "gen.go")
+	p.Trim(f)
+	p.AddLineDirectives(f)
+
+	var buf bytes.Buffer
+	if err := p.WriteFile(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+
+	// The added directives point to where the existing directives, which
+	// are kept as the doc comment of Eval, map the retained code.
+	var got []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "//line ") {
+			got = append(got, filepath.Base(line[len("//line "):]))
+		}
+	}
+	want := []string{"gen.go:9", "calc.y:10", "calc.y:14"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("directives point to %v, want %v\n%s", got, want, buf.Bytes())
+	}
+}
@@ -0,0 +1,81 @@
+package discover
+
+import "go/ast"
+
+// FuncMetric holds size metrics of a covered function.
+type FuncMetric struct {
+	Func    *ast.FuncDecl
+	Stmts   int // number of simple statements in the function
+	Covered int // number of those statements that were covered
+	Size    int // size of the declaration in bytes, excluding its doc comment
+}
+
+// FuncMetrics returns metrics for each covered function, in source order.
+// Statements are counted the same way as by ToCoverProfile. The result can
+// be sorted to find, for example, the largest covered functions.
+func (p *Profile) FuncMetrics() []FuncMetric {
+	var metrics []FuncMetric
+	for _, f := range p.Files {
+		info := p.files[f]
+		if info == nil {
+			continue
+		}
+		stmts := simpleStmts(info.stmts)
+		for _, fe := range info.funcs {
+			// Skip the statements before the func; stmts are sorted
+			for len(stmts) > 0 && posKey(stmts[0].startLine, stmts[0].startCol) < posKey(fe.startLine, fe.startCol) {
+				stmts = stmts[1:]
+			}
+			if !p.Funcs[fe.decl] {
+				continue
+			}
+
+			m := FuncMetric{
+				Func: fe.decl,
+				Size: p.Fset.Position(fe.decl.End()).Offset - p.Fset.Position(fe.decl.Pos()).Offset,
+			}
+			end := posKey(fe.endLine, fe.endCol)
+			for _, s := range stmts {
+				if posKey(s.endLine, s.endCol) > end {
+					break
+				}
+				m.Stmts++
+				if p.Stmts[s.stmt] {
+					m.Covered++
+				}
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// PackageCoverage returns the percentage of statements covered in each
+// package of the profile, keyed by import path. Statements are counted
+// the same way as by ToCoverProfile. Packages without any statements
+// are reported as fully covered.
+func (p *Profile) PackageCoverage() map[string]float64 {
+	total := make(map[string]int)
+	covered := make(map[string]int)
+	for _, f := range p.Files {
+		path := p.ImportPaths[f]
+		total[path] += 0 // record packages without statements
+		if info := p.files[f]; info != nil {
+			for _, s := range simpleStmts(info.stmts) {
+				total[path]++
+				if p.Stmts[s.stmt] {
+					covered[path]++
+				}
+			}
+		}
+	}
+
+	pct := make(map[string]float64)
+	for path, n := range total {
+		pct[path] = 100
+		if n > 0 {
+			pct[path] = 100 * float64(covered[path]) / float64(n)
+		}
+	}
+	return pct
+}
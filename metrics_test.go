@@ -0,0 +1,90 @@
+package discover
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestFuncMetrics(t *testing.T) {
+	p := loadTestdata(t, "calls")
+	got := make(map[string][2]int)
+	var order []string
+	for _, m := range p.FuncMetrics() {
+		name := FuncName(m.Func)
+		order = append(order, name)
+		got[name] = [2]int{m.Stmts, m.Covered}
+		if name == "c" {
+			// func c() int {
+			// 	return 1
+			// }
+			if want := len("func c() int {\n\treturn 1\n}"); m.Size != want {
+				t.Errorf("size of c = %d, want %d", m.Size, want)
+			}
+		}
+	}
+
+	// The statement in the function literal of S.M is part of the
+	// return statement, and the uncovered function is left out.
+	want := map[string][2]int{
+		"Run": {1, 1}, "a": {1, 1}, "b": {2, 2}, "c": {1, 1},
+		"S.M": {1, 1}, "ping": {2, 2}, "pong": {1, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statements and covered statements = %v, want %v", got, want)
+	}
+	if want := []string{"Run", "a", "b", "c", "S.M", "ping", "pong"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+
+	// A partially covered function.
+	p = loadTestdata(t, "trim")
+	clamp := funcDecl(testFile(t, p, "trim.go"), "Clamp")
+	found := false
+	for _, m := range p.FuncMetrics() {
+		if m.Func == clamp {
+			found = true
+			if m.Stmts != 4 || m.Covered != 2 {
+				t.Errorf("Clamp has %d of %d statements covered, want 2 of 4", m.Covered, m.Stmts)
+			}
+		}
+	}
+	if !found {
+		t.Error("no metrics for Clamp")
+	}
+}
+
+func TestPackageCoverage(t *testing.T) {
+	var profs []*cover.Profile
+	for _, name := range []string{"calls", "fields", "typed"} {
+		ps, err := cover.ParseProfiles(filepath.Join("testdata", name, "cover.out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		profs = append(profs, ps...)
+	}
+	p, err := ParseProfile(profs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unlike go test -cover, the range statement of Total and the
+	// statement in the function literal of S.M are not counted.
+	want := map[string]float64{
+		testdataPath + "/calls":  100 * 9.0 / 10, // unused is not covered
+		testdataPath + "/fields": 100 * 4.0 / 5,  // (*T).Reset is not covered
+		testdataPath + "/typed":  100 * 4.0 / 6,  // nor are the Circle methods
+	}
+	got := p.PackageCoverage()
+	if len(got) != len(want) {
+		t.Errorf("PackageCoverage() = %v, want %v", got, want)
+	}
+	for path, pct := range want {
+		if math.Abs(got[path]-pct) > 1e-9 {
+			t.Errorf("coverage of %s = %.2f%%, want %.2f%%", path, got[path], pct)
+		}
+	}
+}
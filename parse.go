@@ -6,12 +6,24 @@
 package discover
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/build"
 	"go/parser"
+	"go/printer"
+	"go/scanner"
 	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"golang.org/x/tools/cover"
 )
@@ -25,90 +37,706 @@ type Profile struct {
 	ImportPaths map[*ast.File]string
 	Files       []*ast.File
 	Fset        *token.FileSet
+
+	// KeepAllMethods causes Trim to retain every method of a type when
+	// at least one of the type's methods was covered, so that the type
+	// keeps its full method set and continues to satisfy its interfaces.
+	KeepAllMethods bool
+
+	// KeepMethodTypes causes Trim to retain the declarations of the types
+	// with covered methods, so that the covered methods are shown along
+	// with their type. The other methods are still trimmed, so the type
+	// as shown may no longer satisfy the interfaces it implements; set
+	// KeepAllMethods, or use ParseProfileTyped, to also keep those.
+	KeepMethodTypes bool
+
+	// TrimInit causes Trim to treat package init functions like any
+	// other function. By default they are always retained, since they
+	// run implicitly and their coverage is easily missed.
+	TrimInit bool
+
+	// Exclude, if non-nil, causes Trim to remove the functions for which
+	// it returns true, even if they were covered or would otherwise be
+	// retained, such as init functions and functions marked with the
+	// //discover:keep directive.
+	Exclude func(f *ast.FuncDecl) bool
+
+	// KeepExportedSignatures causes Trim to retain exported functions
+	// and methods of exported types that were not covered, with their
+	// bodies emptied, so that the output shows the package's public
+	// surface alongside the covered code.
+	KeepExportedSignatures bool
+
+	// GuardContext is the number of untaken if statements to keep around
+	// an else branch that was taken. By default such if statements are
+	// trimmed away and the else branch is inlined into the enclosing
+	// block. With a GuardContext of n, the n untaken guards of an else-if
+	// chain nearest to the else branch are kept, with their bodies left
+	// empty, so that it remains visible under which conditions the code
+	// was reached. Guards further up the chain are trimmed as usual.
+	// Only if statements are affected, since the guards of other
+	// statements are always kept when their bodies were reached.
+	GuardContext int
+
+	// KeepErrorChecks causes Trim to retain error checks of the form
+	// "if err != nil { return err }" even when their bodies were not
+	// reached, since they document how errors are handled. Only if
+	// statements without an else branch that compare an identifier with
+	// nil and whose body ends in a return statement or a call of panic
+	// are considered error checks.
+	KeepErrorChecks bool
+
+	// KeepSpacing causes WriteFile to preserve the blank lines of the
+	// original source between retained code, instead of leaving a blank
+	// line wherever code was trimmed away.
+	KeepSpacing bool
+
+	// Significant, if non-nil, causes Trim to collapse each run of two or
+	// more consecutive statements for which it returns false into a single
+	// comment such as "// ... 3 statements", leaving the structure of the
+	// covered code. IsSignificant is a suitable default. Since the collapsed
+	// statements may declare variables used later on, the result is meant
+	// for reading and may not compile.
+	Significant func(ast.Stmt) bool
+
+	// FieldUsage causes Trim to retain the declarations of struct types
+	// whose fields are accessed by covered code in the same package, with
+	// a comment listing the accessed fields. Without type information,
+	// the accesses are found on a best-effort basis.
+	FieldUsage bool
+
+	// Printer, if non-nil, is the printer configuration WriteFile uses
+	// instead of gofmt formatting, such as to indent with spaces.
+	Printer *printer.Config
+
+	// TypesInfo holds type information for the files of the profile.
+	// It is only set by ParseProfileTyped.
+	TypesInfo *types.Info
+
+	// Skipped lists the files that were skipped during parsing,
+	// as requested by the parse options.
+	Skipped []SkippedFile
+
+	opts      *Options                // parse options; never nil
+	files     map[*ast.File]*fileInfo // per-file parse results
+	hits      map[*ast.FuncDecl]int   // times each covered func was entered
+	unmatched []UnmatchedBlock
+	usage     map[string]*pkgUsage // by import path, as recorded by Trim
+}
+
+// UnmatchedBlock is a block in a cover profile that did not overlap
+// any function or statement in the parsed file.
+type UnmatchedBlock struct {
+	FileName string // file name as given in the cover profile
+	cover.ProfileBlock
+}
+
+// Unmatched returns the profile blocks that did not overlap any function
+// or statement in the parsed files, in the order they were parsed. This
+// can happen for files using //line directives, cgo or other generated
+// code, and helps explain coverage that does not show up as expected.
+func (p *Profile) Unmatched() []UnmatchedBlock {
+	return p.unmatched
+}
+
+// Packages returns the sorted, unique import paths of the packages
+// of the files in the profile.
+func (p *Profile) Packages() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, f := range p.Files {
+		if path := p.ImportPaths[f]; !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// fileInfo holds the parse results for a single file in a Profile.
+type fileInfo struct {
+	name  string // file name as given in the cover profile
+	funcs []*funcExtent
+	stmts []*stmtExtent
+}
+
+// Options control the parsing of coverage profiles.
+type Options struct {
+	// Cache, if non-nil, is consulted before parsing each file and
+	// is updated with the files that were parsed.
+	Cache *FileCache
+
+	// SkipMissing causes files in the profiles that no longer exist to be
+	// skipped instead of failing the parse. The skipped files are recorded
+	// in the Skipped field of the resulting Profile.
+	SkipMissing bool
+
+	// SkipParseErrors causes files in the profiles that fail to parse to
+	// be skipped instead of failing the parse. Like missing files, the
+	// skipped files are recorded in the Skipped field of the Profile.
+	SkipParseErrors bool
+
+	// SkipTests causes test files (files whose names end in "_test.go")
+	// to be left out of the Profile.
+	SkipTests bool
+
+	// Context is the build context used to locate the files in the
+	// profiles. It should match the configuration the tests were run
+	// with, such as their build tags. If nil, build.Default is used.
+	Context *build.Context
+
+	// SrcPrefix and SrcRoot relocate the files in the profiles, such as
+	// when the tests were run on a machine with the source checked out at
+	// a different path. A file name equal to SrcPrefix or starting with
+	// SrcPrefix followed by a slash has that prefix replaced by SrcRoot
+	// before the file is located; other file names are left unchanged.
+	// SrcPrefix may also be an import path prefix, such as a module path,
+	// to locate its packages in the SrcRoot directory.
+	SrcPrefix, SrcRoot string
+
+	// Progress, if non-nil, is called after each file in the profiles
+	// has been parsed (or skipped), with the file name as given in the
+	// profile and the number of files done out of the total.
+	Progress func(fileName string, done, total int)
+}
+
+// relocate applies the SrcPrefix and SrcRoot options to a file name
+// from a cover profile.
+func (o *Options) relocate(fileName string) string {
+	prefix := strings.TrimSuffix(o.SrcPrefix, "/")
+	if prefix == "" || !strings.HasPrefix(fileName, prefix) {
+		return fileName
+	}
+	rest := fileName[len(prefix):]
+	if rest != "" && rest[0] != '/' {
+		return fileName // e.g. "/src/foobar" for prefix "/src/foo"
+	}
+	return filepath.Join(o.SrcRoot, filepath.FromSlash(rest))
+}
+
+// SkippedFile describes a file in a cover profile that was skipped
+// during parsing.
+type SkippedFile struct {
+	FileName string // file name as given in the cover profile
+	Err      error  // reason the file was skipped
 }
 
 // ParseProfile parses a set of coverage profiles to produce a *Profile.
+// The files of the resulting Profile are sorted by file name.
 func ParseProfile(profs []*cover.Profile) (*Profile, error) {
-	profile := &Profile{
-		Stmts:       make(map[ast.Stmt]bool),
-		Funcs:       make(map[*ast.FuncDecl]bool),
-		ImportPaths: make(map[*ast.File]string),
-		Fset:        token.NewFileSet(),
+	return ParseProfileOptions(profs, nil)
+}
+
+// ParseProfileOptions is like ParseProfile but takes options to control
+// the parsing. A nil opts is equivalent to the zero Options.
+func ParseProfileOptions(profs []*cover.Profile, opts *Options) (*Profile, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	fset := token.NewFileSet()
+	if opts.Cache != nil {
+		fset = opts.Cache.fset
 	}
 
-	for _, prof := range profs {
-		file, importPath, err := findFile(prof.FileName)
-		if err != nil {
+	profile := newProfile(fset)
+	profile.opts = opts
+	for i, prof := range profs {
+		if err := profile.addFile(prof); err != nil {
 			return nil, err
 		}
+		if opts.Progress != nil {
+			opts.Progress(prof.FileName, i+1, len(profs))
+		}
+	}
+	profile.sortFiles()
+	return profile, nil
+}
 
-		f, funcs, stmts, err := findFuncs(profile.Fset, file)
+// ParseProfileFromAST is like ParseProfile, but matches the coverage
+// against the given files, already parsed into fset with comments, instead
+// of parsing the files from disk. This avoids parsing the files again when
+// they have already been loaded, such as by go/packages.
+//
+// The files in the profiles are matched by import path and base name (or
+// by absolute path) with the file names recorded in fset, so the files
+// must have been parsed from their actual location on disk. Generated
+// files are also matched by the file names of their //line directives.
+// It is an error for a file in the profiles not to be among files.
+func ParseProfileFromAST(fset *token.FileSet, files []*ast.File, profs []*cover.Profile) (*Profile, error) {
+	type parsedFile struct {
+		f          *ast.File
+		importPath string
+	}
+	byName := make(map[string]parsedFile)
+	for _, f := range files {
+		name := fset.File(f.Pos()).Name()
+		importPath, err := dirImportPath(&build.Default, filepath.Dir(name))
 		if err != nil {
-			return nil, err
+			// Only an absolute path in the profiles can match.
+			byName[name] = parsedFile{f, ""}
+			continue
 		}
-		profile.Files = append(profile.Files, f)
-		profile.ImportPaths[f] = importPath
-
-		blocks := prof.Blocks
-		for len(funcs) > 0 {
-			f := funcs[0]
-			for i, b := range blocks {
-				if b.StartLine > f.endLine || (b.StartLine == f.endLine && b.StartCol >= f.endCol) {
-					// Past the end of the func
-					funcs = funcs[1:]
-					blocks = blocks[i:]
-					break
-				}
-				if b.EndLine < f.startLine || (b.EndLine == f.startLine && b.EndCol <= f.startCol) {
-					// Before the beginning of the func
-					continue
-				}
-				if b.Count > 0 {
-					profile.Funcs[f.decl] = true
+		byName[name] = parsedFile{f, importPath}
+		byName[path.Join(importPath, filepath.Base(name))] = parsedFile{f, importPath}
+
+		// The cover tool names the blocks of generated files after
+		// the source file given by their //line directives.
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				if target, ok := lineDirectiveTarget(c.Text); ok {
+					key := path.Join(importPath, filepath.Base(target))
+					if _, ok := byName[key]; !ok {
+						byName[key] = parsedFile{f, importPath}
+					}
 				}
-				funcs = funcs[1:]
-				break
 			}
 		}
+	}
 
-		blocks = prof.Blocks // reset to all blocks
-		for len(stmts) > 0 {
-			s := stmts[0]
-			for i, b := range blocks {
-				if b.StartLine > s.endLine || (b.StartLine == s.endLine && b.StartCol >= s.endCol) {
-					// Past the end of the statement
-					stmts = stmts[1:]
-					blocks = blocks[i:]
-					break
-				}
-				if b.EndLine < s.startLine || (b.EndLine == s.startLine && b.EndCol <= s.startCol) {
-					// Before the beginning of the statement
-					continue
-				}
-				if b.Count > 0 {
-					profile.Stmts[s.stmt] = true
-				}
-				stmts = stmts[1:]
-				break
+	profile := newProfile(fset)
+	for _, prof := range profs {
+		pf, ok := byName[prof.FileName]
+		if !ok {
+			return nil, fmt.Errorf("can't find %q among the given files: %w", prof.FileName, os.ErrNotExist)
+		}
+		funcs, stmts := fileExtents(fset, pf.f)
+		profile.Files = append(profile.Files, pf.f)
+		profile.ImportPaths[pf.f] = pf.importPath
+		profile.files[pf.f] = &fileInfo{name: prof.FileName, funcs: funcs, stmts: stmts}
+		profile.addCoverage(prof, funcs, stmts)
+	}
+	profile.sortFiles()
+	return profile, nil
+}
+
+// ParseProfileStream is like ParseProfile, but instead of accumulating
+// every parsed file it calls fn once per file with a *Profile holding only
+// that file and its coverage. This bounds memory use to a single file at
+// a time. The *Profile passed to fn must not be retained after fn returns.
+// Options that need to see the whole package, such as KeepAllMethods,
+// only take the current file into account.
+//
+// If fn returns an error, ParseProfileStream stops and returns it.
+func ParseProfileStream(profs []*cover.Profile, fn func(p *Profile, f *ast.File) error) error {
+	for _, prof := range profs {
+		profile := newProfile(token.NewFileSet())
+		if err := profile.addFile(prof); err != nil {
+			return err
+		}
+		for _, f := range profile.Files {
+			if err := fn(profile, f); err != nil {
+				return err
 			}
 		}
 	}
+	return nil
+}
 
-	return profile, nil
+// newProfile returns an empty *Profile using fset for positions.
+func newProfile(fset *token.FileSet) *Profile {
+	return &Profile{
+		Stmts:       make(map[ast.Stmt]bool),
+		Funcs:       make(map[*ast.FuncDecl]bool),
+		ImportPaths: make(map[*ast.File]string),
+		Fset:        fset,
+		opts:        &Options{},
+		files:       make(map[*ast.File]*fileInfo),
+		hits:        make(map[*ast.FuncDecl]int),
+	}
+}
+
+// sortFiles sorts p.Files by file name, to make the order
+// independent of the order of the cover profiles.
+func (p *Profile) sortFiles() {
+	sort.SliceStable(p.Files, func(i, j int) bool {
+		return p.Fset.File(p.Files[i].Pos()).Name() < p.Fset.File(p.Files[j].Pos()).Name()
+	})
+}
+
+// addFile parses the file referenced by prof and records its coverage.
+func (p *Profile) addFile(prof *cover.Profile) error {
+	if p.opts.SkipTests && strings.HasSuffix(prof.FileName, "_test.go") {
+		return nil
+	}
+
+	_, funcs, stmts, err := p.loadFile(prof.FileName)
+	if err != nil {
+		var parseErr scanner.ErrorList
+		if (p.opts.SkipMissing && errors.Is(err, os.ErrNotExist)) ||
+			(p.opts.SkipParseErrors && errors.As(err, &parseErr)) {
+			p.Skipped = append(p.Skipped, SkippedFile{FileName: prof.FileName, Err: err})
+			return nil
+		}
+		return err
+	}
+	p.addCoverage(prof, funcs, stmts)
+	return nil
+}
+
+// addCoverage records the coverage of the funcs and stmts of the file
+// referenced by prof.
+func (p *Profile) addCoverage(prof *cover.Profile, funcs []*funcExtent, stmts []*stmtExtent) {
+	for _, fn := range coveredFuncDecls(funcs, prof.Blocks) {
+		p.Funcs[fn] = true
+	}
+	for fn, count := range funcHits(funcs, prof.Blocks) {
+		p.hits[fn] += count
+	}
+	for _, stmt := range coveredStmts(stmts, prof.Blocks) {
+		p.Stmts[stmt] = true
+	}
+	for _, b := range unmatchedBlocks(funcs, stmts, prof.Blocks) {
+		p.unmatched = append(p.unmatched, UnmatchedBlock{FileName: prof.FileName, ProfileBlock: b})
+	}
+}
+
+// loadFile resolves and parses the file with the given profile file name
+// and adds it to p.Files, without recording any coverage.
+func (p *Profile) loadFile(fileName string) (*ast.File, []*funcExtent, []*stmtExtent, error) {
+	ctxt := p.opts.Context
+	if ctxt == nil {
+		ctxt = &build.Default
+	}
+	file, importPath, err := findFile(ctxt, p.opts.relocate(fileName))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var (
+		f     *ast.File
+		funcs []*funcExtent
+		stmts []*stmtExtent
+	)
+	if p.opts.Cache != nil {
+		f, funcs, stmts, err = p.opts.Cache.findFuncs(file)
+	} else {
+		f, funcs, stmts, err = findFuncs(p.Fset, file)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p.Files = append(p.Files, f)
+	p.ImportPaths[f] = importPath
+	p.files[f] = &fileInfo{name: fileName, funcs: funcs, stmts: stmts}
+	return f, funcs, stmts, nil
+}
+
+// coveredFuncDecls returns the declarations of the funcs that were
+// covered according to blocks.
+func coveredFuncDecls(funcs []*funcExtent, blocks []cover.ProfileBlock) []*ast.FuncDecl {
+	var covered []*ast.FuncDecl
+	for _, f := range funcs {
+		b := firstOverlap(&blocks, f.startLine, f.startCol, f.endLine, f.endCol)
+		if b != nil && b.Count > 0 {
+			covered = append(covered, f.decl)
+		}
+	}
+	return covered
+}
+
+// funcHits returns the number of times each of the covered funcs was
+// entered, as given by the count of the first block of its body. In
+// "set" mode, the counts are 1.
+func funcHits(funcs []*funcExtent, blocks []cover.ProfileBlock) map[*ast.FuncDecl]int {
+	hits := make(map[*ast.FuncDecl]int)
+	for _, f := range funcs {
+		b := firstOverlap(&blocks, f.startLine, f.startCol, f.endLine, f.endCol)
+		if b != nil && b.Count > 0 {
+			hits[f.decl] = b.Count
+		}
+	}
+	return hits
+}
+
+// coveredStmts returns the statements among stmts that were covered
+// according to blocks.
+func coveredStmts(stmts []*stmtExtent, blocks []cover.ProfileBlock) []ast.Stmt {
+	var covered []ast.Stmt
+	for _, s := range stmts {
+		b := firstOverlap(&blocks, s.startLine, s.startCol, s.endLine, s.endCol)
+		if b == nil && isEmptyClause(s.stmt) {
+			b = zeroWidthBlock(blocks, s.endLine, s.endCol)
+		}
+		if b != nil && b.Count > 0 {
+			covered = append(covered, s.stmt)
+		}
+	}
+	return covered
+}
+
+// firstOverlap returns the first of the blocks overlapping the given
+// extent, or nil if there is none. The blocks must be sorted by position.
+//
+// Blocks ending before the extent are dropped from *blocks. Since funcs and
+// stmts are visited in order of their start positions, such blocks cannot
+// overlap any later extent either, which makes matching all extents of a
+// file a single merge-style pass.
+func firstOverlap(blocks *[]cover.ProfileBlock, startLine, startCol, endLine, endCol int) *cover.ProfileBlock {
+	start, end := posKey(startLine, startCol), posKey(endLine, endCol)
+	bs := *blocks
+	for len(bs) > 0 && posKey(bs[0].EndLine, bs[0].EndCol) <= start {
+		bs = bs[1:] // before the beginning of the extent
+	}
+	*blocks = bs
+	if len(bs) == 0 || posKey(bs[0].StartLine, bs[0].StartCol) >= end {
+		return nil // past the end of the extent
+	}
+	return &bs[0]
+}
+
+// isEmptyClause reports whether stmt is a case or comm clause
+// with an empty body.
+func isEmptyClause(stmt ast.Stmt) bool {
+	switch s := stmt.(type) {
+	case *ast.CaseClause:
+		return len(s.Body) == 0
+	case *ast.CommClause:
+		return len(s.Body) == 0
+	}
+	return false
+}
+
+// zeroWidthBlock returns the first of the blocks if it is a zero-width
+// block at the given position, or nil otherwise. The cover tool records
+// the empty body of a clause as such a block at the end of the clause,
+// which overlaps nothing. It is meant to be called after firstOverlap
+// found no block overlapping the clause.
+func zeroWidthBlock(blocks []cover.ProfileBlock, line, col int) *cover.ProfileBlock {
+	if len(blocks) == 0 {
+		return nil
+	}
+	b := &blocks[0]
+	if b.StartLine == line && b.StartCol == col && b.EndLine == line && b.EndCol == col {
+		return b
+	}
+	return nil
+}
+
+// unmatchedBlocks returns the blocks that do not overlap any of the
+// funcs or stmts.
+func unmatchedBlocks(funcs []*funcExtent, stmts []*stmtExtent, blocks []cover.ProfileBlock) []cover.ProfileBlock {
+	// Build the sorted, disjoint union of the extents
+	type span struct{ start, end int64 }
+	var spans []span
+	for _, f := range funcs {
+		spans = append(spans, span{posKey(f.startLine, f.startCol), posKey(f.endLine, f.endCol)})
+	}
+	for _, s := range stmts {
+		spans = append(spans, span{posKey(s.startLine, s.startCol), posKey(s.endLine, s.endCol)})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var union []span
+	for _, s := range spans {
+		if n := len(union); n > 0 && s.start <= union[n-1].end {
+			if s.end > union[n-1].end {
+				union[n-1].end = s.end
+			}
+			continue
+		}
+		union = append(union, s)
+	}
+
+	var unmatched []cover.ProfileBlock
+	for _, b := range blocks {
+		start, end := posKey(b.StartLine, b.StartCol), posKey(b.EndLine, b.EndCol)
+		if start == end {
+			// A zero-width block, for an empty body, matches the
+			// extent it ends.
+			i := sort.Search(len(union), func(i int) bool { return union[i].end >= start })
+			if i == len(union) || union[i].start > start {
+				unmatched = append(unmatched, b)
+			}
+			continue
+		}
+		// Find the first span not ending before the block starts
+		i := sort.Search(len(union), func(i int) bool { return union[i].end > start })
+		if i == len(union) || union[i].start >= end {
+			unmatched = append(unmatched, b)
+		}
+	}
+	return unmatched
+}
+
+// posKey returns an integer that orders positions by line and column.
+func posKey(line, col int) int64 {
+	return int64(line)<<32 | int64(col)
+}
+
+// ImportPathFor returns the import path of the package containing the file
+// with the given name, as it appears in a cover profile. This is the import
+// path recorded in Profile.ImportPaths for the file. Both GOPATH and module
+// layouts are supported.
+func ImportPathFor(fileName string) (string, error) {
+	_, importPath, err := findFile(&build.Default, fileName)
+	return importPath, err
 }
 
 // findFile tries to find the full path to a file, by looking in $GOROOT
-// and $GOPATH.
-func findFile(file string) (filename, pkgPath string, err error) {
+// and $GOPATH as configured by ctxt, as well as in the vendor directories
+// enclosing the current directory. Absolute paths to existing files are
+// used as-is.
+func findFile(ctxt *build.Context, file string) (filename, pkgPath string, err error) {
+	if filepath.IsAbs(file) {
+		if _, err := os.Stat(file); err == nil {
+			pkgPath, err := dirImportPath(ctxt, filepath.Dir(file))
+			if err != nil {
+				return "", "", err
+			}
+			return file, pkgPath, nil
+		}
+	}
+
 	dir, file := filepath.Split(file)
 	if dir != "" {
 		dir = dir[:len(dir)-1] // drop trailing '/'
 	}
-	pkg, err := build.Import(dir, ".", build.FindOnly)
+	// The import may resolve to a directory that doesn't hold the file,
+	// or not at all, such as when the tests used a vendored copy of the
+	// package or the package in another $GOPATH entry. Prefer the first
+	// directory that actually has it.
+	pkgDir, pkgPath := "", dir
+	pkg, err := ctxt.Import(dir, ".", build.FindOnly)
+	if err == nil {
+		pkgDir, pkgPath = pkg.Dir, pkg.ImportPath
+	}
+	if pkgDir == "" || !fileExists(filepath.Join(pkgDir, file)) {
+		for _, d := range packageDirs(ctxt, dir) {
+			if fileExists(filepath.Join(d, file)) {
+				pkgDir = d
+				break
+			}
+		}
+	}
+	if pkgDir == "" {
+		return "", "", fmt.Errorf("can't find %q: %v: %w", file, err, os.ErrNotExist)
+	}
+
+	filename = filepath.Join(pkgDir, file)
+	if !strings.HasSuffix(file, ".go") {
+		// The cover tool names the blocks of generated files after the
+		// source file given by their //line directives, so look for the
+		// Go file that refers to it.
+		if gen := lineDirectiveFile(pkgDir, file); gen != "" {
+			filename = gen
+		}
+	}
+	return filename, pkgPath, nil
+}
+
+// packageDirs returns the directories that may hold the package with the
+// given import path: its copies in the vendor directories of the current
+// directory and its parents, nearest first, as the go command resolves
+// them, followed by the package in each of the source directories of ctxt.
+func packageDirs(ctxt *build.Context, importPath string) []string {
+	var dirs []string
+	if wd, err := os.Getwd(); err == nil {
+		for dir := wd; ; {
+			dirs = append(dirs, filepath.Join(dir, "vendor", filepath.FromSlash(importPath)))
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	for _, src := range ctxt.SrcDirs() {
+		dirs = append(dirs, filepath.Join(src, filepath.FromSlash(importPath)))
+	}
+	return dirs
+}
+
+// fileExists reports whether name exists and is not a directory.
+func fileExists(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && !fi.IsDir()
+}
+
+// lineDirectiveFile returns the path of the first Go file in dir containing
+// a //line directive referring to a file with the given base name, or "".
+func lineDirectiveFile(dir, name string) string {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, m := range matches {
+		data, err := ioutil.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			if target, ok := lineDirectiveTarget(sc.Text()); ok && filepath.Base(target) == name {
+				return m
+			}
+		}
+	}
+	return ""
+}
+
+// lineDirectiveTarget returns the file name a //line directive refers
+// to, and whether line is such a directive.
+func lineDirectiveTarget(line string) (string, bool) {
+	if !strings.HasPrefix(line, "//line ") {
+		return "", false
+	}
+	// Strip the trailing :line or :line:col
+	target := strings.TrimSpace(line[len("//line "):])
+	for i := 0; i < 2; i++ {
+		if j := strings.LastIndexByte(target, ':'); j >= 0 {
+			if _, err := strconv.Atoi(target[j+1:]); err == nil {
+				target = target[:j]
+			}
+		}
+	}
+	return target, true
+}
+
+// dirImportPath returns the import path of the package in dir, which must
+// be an absolute path. Directories within $GOPATH are resolved by go/build;
+// otherwise the import path is derived from the enclosing module's go.mod.
+func dirImportPath(ctxt *build.Context, dir string) (string, error) {
+	pkg, err := ctxt.ImportDir(dir, build.FindOnly)
 	if err != nil {
-		return "", "", fmt.Errorf("can't find %q: %v", file, err)
+		return "", fmt.Errorf("can't find %q: %v", dir, err)
+	}
+	if pkg.ImportPath != "" && pkg.ImportPath != "." {
+		return pkg.ImportPath, nil
+	}
+
+	for root := dir; ; {
+		data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+		if err == nil {
+			modPath := modulePath(data)
+			if modPath == "" {
+				return "", fmt.Errorf("no module path in %s", filepath.Join(root, "go.mod"))
+			}
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(modPath, filepath.ToSlash(rel)), nil
+		}
+
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", fmt.Errorf("can't determine import path of %q: not in GOPATH or a module", dir)
+		}
+		root = parent
 	}
-	return filepath.Join(pkg.Dir, file), pkg.ImportPath, nil
+}
+
+// modulePath returns the module path declared in the go.mod contents data,
+// or "" if there is none.
+func modulePath(data []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			if p, err := strconv.Unquote(fields[1]); err == nil {
+				return p
+			}
+			return fields[1]
+		}
+	}
+	return ""
 }
 
 // findFuncs parses the file and returns a slice of FuncExtent descriptors.
@@ -117,9 +745,15 @@ func findFuncs(fset *token.FileSet, name string) (*ast.File, []*funcExtent, []*s
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	funcs, stmts := fileExtents(fset, parsedFile)
+	return parsedFile, funcs, stmts, nil
+}
+
+// fileExtents returns the extents of the functions and statements of f.
+func fileExtents(fset *token.FileSet, f *ast.File) ([]*funcExtent, []*stmtExtent) {
 	visitor := &funcVisitor{fset: fset}
-	ast.Walk(visitor, parsedFile)
-	return parsedFile, visitor.funcs, visitor.stmts, nil
+	ast.Walk(visitor, f)
+	return visitor.funcs, visitor.stmts
 }
 
 // funcExtent describes a function's extent in the source by file and position.
@@ -141,6 +775,13 @@ type stmtExtent struct {
 	endCol    int
 }
 
+// contains reports whether the extent of o lies within that of s.
+func (s *stmtExtent) contains(o *stmtExtent) bool {
+	startsAfter := o.startLine > s.startLine || (o.startLine == s.startLine && o.startCol >= s.startCol)
+	endsBefore := o.endLine < s.endLine || (o.endLine == s.endLine && o.endCol <= s.endCol)
+	return startsAfter && endsBefore
+}
+
 // funcVisitor implements the visitor that builds the function position list for a file.
 type funcVisitor struct {
 	fset  *token.FileSet
@@ -150,9 +791,11 @@ type funcVisitor struct {
 
 // Visit implements the ast.Visitor interface.
 func (v *funcVisitor) Visit(node ast.Node) ast.Visitor {
+	// Use the raw positions, ignoring //line directives, since those are
+	// what the cover profile refers to.
 	if f, ok := node.(*ast.FuncDecl); ok {
-		start := v.fset.Position(f.Pos())
-		end := v.fset.Position(f.End())
+		start := v.fset.PositionFor(f.Pos(), false)
+		end := v.fset.PositionFor(f.End(), false)
 		fe := &funcExtent{
 			decl:      f,
 			startLine: start.Line,
@@ -162,7 +805,7 @@ func (v *funcVisitor) Visit(node ast.Node) ast.Visitor {
 		}
 		v.funcs = append(v.funcs, fe)
 	} else if s, ok := node.(ast.Stmt); ok {
-		start, end := v.fset.Position(s.Pos()), v.fset.Position(s.End())
+		start, end := v.fset.PositionFor(s.Pos(), false), v.fset.PositionFor(s.End(), false)
 		se := &stmtExtent{
 			stmt:      s,
 			startLine: start.Line,
@@ -171,6 +814,26 @@ func (v *funcVisitor) Visit(node ast.Node) ast.Visitor {
 			endCol:    end.Column,
 		}
 		v.stmts = append(v.stmts, se)
+
+		// The Assign of a type switch (the "v := x.(type)" or "x.(type)"
+		// part) is not a statement of its own: it only shares the switch
+		// header with the enclosing block's coverage. Skip it, so it gets
+		// no extent of its own, but not the function literals within it,
+		// whose statements are covered on their own.
+		if ts, ok := s.(*ast.TypeSwitchStmt); ok {
+			if ts.Init != nil {
+				ast.Walk(v, ts.Init)
+			}
+			ast.Inspect(ts.Assign, func(n ast.Node) bool {
+				if lit, ok := n.(*ast.FuncLit); ok {
+					ast.Walk(v, lit)
+					return false
+				}
+				return true
+			})
+			ast.Walk(v, ts.Body)
+			return nil
+		}
 	}
 	return v
 }
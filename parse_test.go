@@ -0,0 +1,415 @@
+package discover
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+const testdataPath = "github.com/eandre/discover/testdata"
+
+func TestParseProfileAbsolutePath(t *testing.T) {
+	abs, err := filepath.Abs(filepath.Join("testdata", "trim", "trim.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profs, err := cover.ParseProfiles(filepath.Join("testdata", "trim", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prof := range profs {
+		prof.FileName = filepath.Join(filepath.Dir(abs), filepath.Base(prof.FileName))
+	}
+
+	p, err := ParseProfile(profs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := testFile(t, p, "trim.go")
+	if got := p.Fset.File(f.Pos()).Name(); got != abs {
+		t.Errorf("file name = %q, want %q", got, abs)
+	}
+	if got, want := p.ImportPaths[f], testdataPath+"/trim"; got != want {
+		t.Errorf("import path = %q, want %q", got, want)
+	}
+	if fn := funcDecl(f, "Covered"); !p.Funcs[fn] {
+		t.Error("Covered is not covered")
+	}
+}
+
+func TestFindFile(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "trim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := filepath.Join(dir, "trim.go")
+
+	tests := []struct {
+		file, wantFile string
+	}{
+		{abs, abs},
+		{testdataPath + "/trim/trim.go", abs},
+	}
+	for _, tt := range tests {
+		file, importPath, err := findFile(&build.Default, tt.file)
+		if err != nil {
+			t.Errorf("findFile(%q): %v", tt.file, err)
+			continue
+		}
+		if file != tt.wantFile || importPath != testdataPath+"/trim" {
+			t.Errorf("findFile(%q) = %q, %q; want %q, %q", tt.file, file, importPath, tt.wantFile, testdataPath+"/trim")
+		}
+	}
+
+	_, _, err = findFile(&build.Default, filepath.Join(dir, "missing.go"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("findFile of missing file: got error %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestDirImportPath(t *testing.T) {
+	root, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir, want string
+	}{
+		{root, "github.com/eandre/discover"},
+		{filepath.Join(root, "testdata", "trim"), testdataPath + "/trim"},
+		{filepath.Join(root, "cmd", "discover"), "github.com/eandre/discover/cmd/discover"},
+	}
+	for _, tt := range tests {
+		got, err := dirImportPath(&build.Default, tt.dir)
+		if err != nil {
+			t.Errorf("dirImportPath(%q): %v", tt.dir, err)
+		} else if got != tt.want {
+			t.Errorf("dirImportPath(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestParseProfileEmptyClause(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+
+	// The cover tool records the empty body of the default clause as
+	// a zero-width block, which must still count as a visit.
+	sel := funcDecl(f, "Select").Body.List[0].(*ast.SelectStmt)
+	def := sel.Body.List[1]
+	if !p.Stmts[def] {
+		t.Error("empty default clause is not covered")
+	}
+	if u := p.Unmatched(); len(u) != 0 {
+		t.Errorf("unmatched blocks: %v", u)
+	}
+}
+
+func TestParseProfileSkipTests(t *testing.T) {
+	profs, err := cover.ParseProfiles(filepath.Join("testdata", "trim", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mix in coverage of the test file, as when tests test each other.
+	profs = append(profs, &cover.Profile{
+		FileName: testdataPath + "/trim/trim_test.go",
+		Mode:     "set",
+		Blocks:   []cover.ProfileBlock{{StartLine: 6, StartCol: 2, EndLine: 6, EndCol: 11, NumStmt: 1, Count: 1}},
+	})
+
+	for _, skip := range []bool{false, true} {
+		p, err := ParseProfileOptions(profs, &Options{SkipTests: skip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range p.Files {
+			names = append(names, filepath.Base(p.Fset.File(f.Pos()).Name()))
+		}
+		want := []string{"trim.go", "trim_test.go"}
+		if skip {
+			want = want[:1]
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("SkipTests=%v: files = %v, want %v", skip, names, want)
+		}
+	}
+}
+
+func TestParseProfileLineDirectives(t *testing.T) {
+	profs, err := cover.ParseProfiles(filepath.Join("testdata", "linedir", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(t *testing.T, p *Profile) {
+		t.Helper()
+		f := testFile(t, p, "gen.go")
+		if got, want := p.ImportPaths[f], testdataPath+"/linedir"; got != want {
+			t.Errorf("import path = %q, want %q", got, want)
+		}
+		if !p.Funcs[funcDecl(f, "Eval")] {
+			t.Error("Eval is not covered")
+		}
+		if p.Funcs[funcDecl(f, "unused")] {
+			t.Error("unused is covered")
+		}
+		if u := p.Unmatched(); len(u) != 0 {
+			t.Errorf("unmatched blocks: %v", u)
+		}
+	}
+
+	t.Run("ParseProfile", func(t *testing.T) {
+		p, err := ParseProfile(profs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, p)
+	})
+	t.Run("ParseProfileFromAST", func(t *testing.T) {
+		name, err := filepath.Abs(filepath.Join("testdata", "linedir", "gen.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := ParseProfileFromAST(fset, []*ast.File{f}, profs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, p)
+	})
+}
+
+func TestFindFileVendor(t *testing.T) {
+	gopath := t.TempDir()
+	write := func(path string) string {
+		t.Helper()
+		name := filepath.Join(gopath, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte("package dep\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	// The tests of app used its vendored copy of dep, which has a file
+	// that the copy of dep in $GOPATH lacks.
+	vendored := write("src/example.com/app/vendor/example.com/dep/dep.go")
+	shared := write("src/example.com/dep/other.go")
+	write("src/example.com/app/app.go")
+	onlyVendored := write("src/example.com/app/vendor/example.com/vendored/v.go")
+
+	defer setenv(t, "GO111MODULE", "off")()
+	defer chdir(t, filepath.Join(gopath, "src", "example.com", "app"))()
+	ctxt := build.Default
+	ctxt.GOPATH = gopath
+
+	tests := []struct {
+		file, wantFile, wantPath string
+	}{
+		{"example.com/dep/dep.go", vendored, "example.com/dep"},
+		{"example.com/dep/other.go", shared, "example.com/dep"},
+		{"example.com/vendored/v.go", onlyVendored, "example.com/vendored"},
+	}
+	for _, tt := range tests {
+		file, importPath, err := findFile(&ctxt, tt.file)
+		if err != nil {
+			t.Errorf("findFile(%q): %v", tt.file, err)
+			continue
+		}
+		if file != tt.wantFile || importPath != tt.wantPath {
+			t.Errorf("findFile(%q) = %q, %q; want %q, %q", tt.file, file, importPath, tt.wantFile, tt.wantPath)
+		}
+	}
+}
+
+// setenv sets the environment variable key to value, and returns
+// a function restoring its previous value.
+func setenv(t *testing.T, key, value string) func() {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// chdir changes the current directory to dir, and returns a function
+// changing it back.
+func chdir(t *testing.T, dir string) func() {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseProfile(b *testing.B) {
+	profs := []*cover.Profile{syntheticProfile(b, 5000, 1)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseProfile(profs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMatchBlocks(b *testing.B) {
+	prof := syntheticProfile(b, 5000, 1)
+	_, funcs, stmts, err := findFuncs(token.NewFileSet(), prof.FileName)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := newProfile(token.NewFileSet())
+		p.addCoverage(prof, funcs, stmts)
+	}
+}
+
+func TestParseProfileTypeSwitch(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	body := funcDecl(f, "Kind").Body.List
+	bare := body[0].(*ast.TypeSwitchStmt)   // switch x.(type)
+	assign := body[1].(*ast.TypeSwitchStmt) // switch v := ....(type)
+
+	// The Assign parts are not statements of their own.
+	for _, se := range p.files[f].stmts {
+		if se.stmt == bare.Assign || se.stmt == assign.Assign {
+			t.Errorf("type switch Assign %T has an extent", se.stmt)
+		}
+	}
+
+	// The function literal in the Assign is matched on its own.
+	var ret ast.Stmt
+	ast.Inspect(assign.Assign, func(n ast.Node) bool {
+		if r, ok := n.(*ast.ReturnStmt); ok {
+			ret = r
+		}
+		return true
+	})
+	if !p.Stmts[ret] {
+		t.Error("return statement of the function literal in the Assign is not covered")
+	}
+
+	tests := []struct {
+		stmt ast.Stmt
+		want bool
+	}{
+		{bare, true},
+		{bare.Body.List[0], false},
+		{assign, true},
+		{assign.Body.List[0], true},
+	}
+	for _, tt := range tests {
+		if got := p.Stmts[tt.stmt]; got != tt.want {
+			t.Errorf("statement at %v: covered = %v, want %v", p.Fset.Position(tt.stmt.Pos()), got, tt.want)
+		}
+	}
+}
+
+func TestParseProfileStream(t *testing.T) {
+	profs, err := cover.ParseProfiles(filepath.Join("testdata", "fields", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole := loadTestdata(t, "fields")
+
+	// Each file is trimmed as it would be in the profile of all files.
+	var names []string
+	err = ParseProfileStream(profs, func(p *Profile, f *ast.File) error {
+		name := filepath.Base(p.Fset.File(f.Pos()).Name())
+		names = append(names, name)
+		if len(p.Files) != 1 || p.Files[0] != f {
+			t.Errorf("%s: profile holds %d files, want only the one given", name, len(p.Files))
+		}
+		if got, want := p.ImportPaths[f], testdataPath+"/fields"; got != want {
+			t.Errorf("%s: import path = %q, want %q", name, got, want)
+		}
+		var got, want bytes.Buffer
+		p.Trim(f)
+		if err := p.WriteFile(&got, f); err != nil {
+			return err
+		}
+		wf := testFile(t, whole, name)
+		whole.Trim(wf)
+		if err := whole.WriteFile(&want, wf); err != nil {
+			return err
+		}
+		if got.String() != want.String() {
+			t.Errorf("%s: trimmed stream output:\n%s\nwant:\n%s", name, got.String(), want.String())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.go", "b.go"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("streamed files %v, want %v", names, want)
+	}
+
+	// An error from the callback stops the stream.
+	stop := errors.New("stop")
+	calls := 0
+	err = ParseProfileStream(profs, func(*Profile, *ast.File) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("ParseProfileStream returned %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
+
+func TestParseProfileUnmatched(t *testing.T) {
+	var profs []*cover.Profile
+	for _, name := range []string{"calls", "trim"} {
+		ps, err := cover.ParseProfiles(filepath.Join("testdata", name, "cover.out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		profs = append(profs, ps...)
+	}
+	// A block past the end of trim.go, as if the file had changed since
+	// the profile was written.
+	trim := profs[len(profs)-1]
+	stray := cover.ProfileBlock{StartLine: 1000, StartCol: 2, EndLine: 1002, EndCol: 3, NumStmt: 2, Count: 1}
+	trim.Blocks = append(trim.Blocks, stray)
+
+	p, err := ParseProfile(profs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []UnmatchedBlock{{FileName: testdataPath + "/trim/trim.go", ProfileBlock: stray}}
+	if got := p.Unmatched(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmatched() = %+v, want %+v", got, want)
+	}
+}
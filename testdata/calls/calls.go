@@ -0,0 +1,48 @@
+// Package calls holds code for testing the call graph of package discover.
+// After changing it, regenerate its cover profile with:
+//
+//	go test -coverprofile=testdata/calls/cover.out ./testdata/calls
+package calls
+
+// Run is called by the tests.
+func Run() int {
+	return a() + b()
+}
+
+func a() int {
+	return c() + len("a")
+}
+
+func b() int {
+	s := &S{}
+	return s.M() + c()
+}
+
+func c() int {
+	return 1
+}
+
+// S has a method.
+type S struct{}
+
+// M calls a function literal.
+func (s *S) M() int {
+	return func() int { return 1 }()
+}
+
+func unused() int {
+	return a()
+}
+
+// ping and pong are only called by each other, once ping is called by
+// the tests.
+func ping(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return pong(n - 1)
+}
+
+func pong(n int) int {
+	return ping(n)
+}
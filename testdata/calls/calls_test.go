@@ -0,0 +1,8 @@
+package calls
+
+import "testing"
+
+func TestCalls(t *testing.T) {
+	Run()
+	ping(2)
+}
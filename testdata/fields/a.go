@@ -0,0 +1,18 @@
+// Package fields holds code for testing the trimming of package discover
+// across the files of a package. After changing it, regenerate its cover
+// profile with:
+//
+//	go test -coverprofile=testdata/fields/cover.out ./testdata/fields
+package fields
+
+// Sum adds up the fields of t.
+func Sum(t *T) int {
+	n := t.x
+	n += t.y
+	return n
+}
+
+// Total adds up all fields of t.
+func (t *T) Total() int {
+	return Sum(t) + t.z
+}
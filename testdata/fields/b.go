@@ -0,0 +1,11 @@
+package fields
+
+// T holds numbers.
+type T struct {
+	x, y, z int
+}
+
+// Reset is not called by the tests.
+func (t *T) Reset() {
+	t.z = 0
+}
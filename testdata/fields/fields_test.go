@@ -0,0 +1,7 @@
+package fields
+
+import "testing"
+
+func TestFields(t *testing.T) {
+	new(T).Total()
+}
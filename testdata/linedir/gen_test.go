@@ -0,0 +1,7 @@
+package linedir
+
+import "testing"
+
+func TestEval(t *testing.T) {
+	Eval(1)
+}
@@ -0,0 +1,316 @@
+// Package trim holds code for testing the trimming of package discover.
+// After changing it, regenerate its cover profile and the golden files
+// derived from it with:
+//
+//	go test -coverprofile=testdata/trim/cover.out ./testdata/trim
+//	go test -update
+package trim
+
+import "strconv"
+
+// Covered is called by the tests.
+func Covered() int {
+	return helper(1)
+}
+
+func helper(x int) int { return x + 1 }
+
+// Debug is not called by the tests, but is always kept.
+//
+//discover:keep
+func Debug() string {
+	return "debug"
+}
+
+func unused() {}
+
+// Reset is not called by the tests, but is always kept in full.
+//
+//discover:keep
+func Reset(xs []int) {
+	for i := range xs {
+		if xs[i] > 0 {
+			xs[i] = 0
+		}
+	}
+}
+
+// Ranges ranges over channels and values that the tests leave empty.
+func Ranges(ch chan int, chans chan chan int) int {
+	n := 0
+	for v := range ch {
+		n += v
+	}
+	for v := range values() {
+		n += v
+	}
+	for v := range <-chans {
+		n += v
+	}
+	for _, v := range []int{1} {
+		n += v
+	}
+	return n
+}
+
+func values() []int { return nil }
+
+// Select receives from c if a value is ready.
+func Select(c chan int) int {
+	select {
+	case v := <-c:
+		return v
+	default:
+	}
+	return 0
+}
+
+// SelectWait signals started and then waits on channels that are
+// never ready.
+func SelectWait(started chan<- bool, c chan int) int {
+	started <- true
+	select {
+	case v := <-recv(c):
+		return v
+	case c <- value():
+		return 0
+	}
+}
+
+func recv(c chan int) chan int { return c }
+
+func value() int { return 1 }
+
+// Labels sums the positive elements of the rows of xs, up to the first
+// zero.
+func Labels(xs [][]int) int {
+	n := 0
+rows:
+	for _, row := range xs {
+	cols:
+		for _, x := range row {
+			switch {
+			case x < 0:
+				continue cols
+			case x == 0:
+				break rows
+			case x > 100:
+				continue rows
+			}
+			n += x
+		}
+	}
+never:
+	for n > 1000 {
+		n--
+		if n%2 == 0 {
+			continue never
+		}
+	}
+	return n
+}
+
+// Fall describes x, falling through from one case to the next.
+func Fall(x int) string {
+	s := ""
+	switch x {
+	case 1:
+		s = "one"
+		fallthrough
+	case 2:
+	case 3:
+		s = "three"
+	}
+	return s
+}
+
+var registry map[string]int
+
+func init() {
+	registry = make(map[string]int)
+}
+
+// Exported is not called by the tests.
+func Exported(x int) int {
+	if x < 0 {
+		x = -x
+	}
+	return x * 2
+}
+
+func unexported(x int) int {
+	return x * 3
+}
+
+// Counter counts.
+type Counter struct {
+	n int
+}
+
+// Inc is called by the tests.
+func (c *Counter) Inc() {
+	c.n++
+}
+
+// Dec is not called by the tests.
+func (c *Counter) Dec() {
+	c.n--
+}
+
+func (c *Counter) reset() {
+	c.n = 0
+}
+
+type counter struct {
+	n int
+}
+
+// Get is exported, but its receiver type is not.
+func (c counter) Get() int {
+	return c.n
+}
+
+// Kind describes the dynamic type of x.
+func Kind(x interface{}) string {
+	switch x.(type) {
+	case int:
+		return "int"
+	}
+	switch v := apply(func() interface{} {
+		return x
+	}).(type) {
+	case string:
+		return v
+	}
+	return "other"
+}
+
+func apply(f func() interface{}) interface{} { return f() }
+
+// Closures returns a closure, leaving another one uncalled.
+func Closures(x int) func() int {
+	double := func() int {
+		return x * 2
+	}
+	_ = double
+	return func() int {
+		if x < 0 {
+			return -x
+		}
+		return x
+	}
+}
+
+// Launch makes x positive on a goroutine.
+func Launch(x int) int {
+	done := make(chan int)
+	defer func() {
+		if r := recover(); r != nil {
+			panic(r)
+		}
+	}()
+	go func() {
+		if x < 0 {
+			x = -x
+		}
+		done <- x
+	}()
+	return <-done
+}
+
+// Clamp limits x to 10, unless it is negative.
+func Clamp(x int) int {
+	if x < 0 {
+		goto done
+	}
+	if x > 10 {
+		x = 10
+	}
+done:
+	if x == 0 {
+		x = 1
+	}
+	return x
+}
+
+// Find returns the index of y in xs, or -1.
+func Find(xs []int, y int) int {
+	i := -1
+search:
+	for j, x := range xs {
+		if x < 0 {
+			continue search
+		}
+		if x == y {
+			i = j
+			break search
+		}
+	}
+	return i
+}
+
+// Sign describes the sign of x.
+func Sign(x int) string {
+	s := "x"
+	s += " is"
+	switch {
+	case x > 0:
+		s += " positive"
+	case x < 0:
+		s += " negative"
+	default:
+		s += " zero"
+	}
+	return s
+}
+
+// Double doubles the number in s, or returns 0 if it is invalid.
+func Double(s string) int {
+	if n, err := strconv.Atoi(s); err != nil {
+		return 0
+	} else {
+		return helper(n) * 2
+	}
+}
+
+// Valid reports whether s is a valid number.
+func Valid(s string) bool {
+	ok := false
+	if n, err := strconv.Atoi(s); err != nil || n < 0 {
+		return false
+	} else {
+		ok = true
+	}
+	return ok
+}
+
+// Grade grades a score.
+func Grade(score int) string {
+	if score >= 90 {
+		return "A"
+	} else if score >= 80 {
+		return "B"
+	} else {
+		return "F"
+	}
+}
+
+// Load parses s, failing on invalid numbers.
+func Load(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Spaced groups its statements with blank lines.
+func Spaced(x int) int {
+	y := x + 1
+	if x < 0 {
+		y = 0
+	}
+	z := y * 2
+
+	return z
+}
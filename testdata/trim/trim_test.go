@@ -0,0 +1,33 @@
+package trim
+
+import "testing"
+
+func TestTrim(t *testing.T) {
+	Covered()
+
+	ch, chans := make(chan int), make(chan chan int, 1)
+	close(ch)
+	chans <- ch
+	Ranges(ch, chans)
+
+	Select(make(chan int))
+	started := make(chan bool)
+	go SelectWait(started, make(chan int))
+	<-started
+
+	Labels([][]int{{1, 0}})
+	Fall(1)
+	new(Counter).Inc()
+	Kind("s")
+	Closures(1)()
+	Launch(1)
+	Clamp(-1)
+	Find([]int{1, 2}, 2)
+	Sign(1)
+	Sign(0)
+	Double("1")
+	Valid("1")
+	Grade(50)
+	Load("1")
+	Spaced(1)
+}
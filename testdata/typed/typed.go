@@ -0,0 +1,41 @@
+// Package typed holds code for testing the trimming of package discover
+// with type information. After changing it, regenerate its cover profile
+// with:
+//
+//	go test -coverprofile=testdata/typed/cover.out ./testdata/typed
+package typed
+
+// Shape is implemented by Square and Circle.
+type Shape interface {
+	Area() int
+}
+
+// Total is called by the tests with squares only.
+func Total(shapes []Shape) int {
+	n := 0
+	for _, s := range shapes {
+		n += s.Area()
+	}
+	return n
+}
+
+// Square is a Shape.
+type Square struct{ side int }
+
+// Area is called through Shape.
+func (s Square) Area() int {
+	return s.side * s.side
+}
+
+// Circle is a Shape too.
+type Circle struct{ r int }
+
+// Area is not called, but implements Shape.
+func (c *Circle) Area() int {
+	return 3 * c.r * c.r
+}
+
+// Radius is not called, and implements nothing.
+func (c *Circle) Radius() int {
+	return c.r
+}
@@ -0,0 +1,7 @@
+package typed
+
+import "testing"
+
+func TestTotal(t *testing.T) {
+	Total([]Shape{Square{2}})
+}
@@ -1,24 +1,252 @@
 package discover
 
-import "go/ast"
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// keepDirective marks a function that should survive trimming regardless
+// of whether it was covered.
+const keepDirective = "//discover:keep"
 
 // Trim trims the AST rooted at node based on the coverage profile,
 // removing irrelevant and unreached parts of the program.
 // If the node is an *ast.File, comments are updated as well using
-// an ast.CommentMap.
+// an ast.CommentMap, and statements are collapsed if p.Significant is set.
+//
+// Functions whose doc comment contains a line consisting of the
+// //discover:keep directive are always retained, as are init functions
+// unless p.TrimInit is set. If uncovered, they are retained in full. Exported functions are
+// retained without their bodies if p.KeepExportedSignatures is set.
+// Functions excluded by p.Exclude are removed in any case.
 func (p *Profile) Trim(node ast.Node) {
+	p.TrimWithKeep(node, nil)
+}
+
+// TrimWithKeep is like Trim, but also retains the functions whose names
+// are in keep, like those with the //discover:keep directive, unless they
+// are excluded by p.Exclude. Names are matched both as given by FuncName
+// (e.g. "Profile.Trim") and unqualified (e.g. "Trim").
+func (p *Profile) TrimWithKeep(node ast.Node, keep map[string]bool) {
+	v := &trimVisitor{p: p, keep: keep}
 	if f, ok := node.(*ast.File); ok {
+		usage := p.recordUsage(f)
+		if p.KeepAllMethods {
+			v.methodTypes = usage.methodTypes
+		}
+		if p.TypesInfo != nil {
+			v.impls = p.interfaceImpls()
+		}
+		if p.FieldUsage {
+			v.fieldUsage = usage.fields
+		}
+		if p.KeepMethodTypes {
+			v.recvTypes = usage.methodTypes
+		}
 		cmap := ast.NewCommentMap(p.Fset, f, f.Comments)
-		ast.Walk(&trimVisitor{p}, f)
+		ast.Walk(v, f)
+		fixLabels(f)
+		var added []*ast.CommentGroup
+		if p.Significant != nil {
+			added = p.collapse(f)
+		}
+		if v.fieldUsage != nil {
+			added = append(added, fieldComments(f, v.fieldUsage)...)
+		}
 		f.Comments = cmap.Filter(f).Comments()
+		addComments(f, added)
 	} else {
-		ast.Walk(&trimVisitor{p}, node)
+		ast.Walk(v, node)
+		fixLabels(node)
 	}
 }
 
+// fixLabels repairs the labels of the functions within node after trimming,
+// which may have removed either a labeled statement or all the branch
+// statements referring to a label. Branch statements referring to labels
+// that no longer exist are removed, as are labels that are no longer used.
+func fixLabels(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				fixFuncLabels(n.Body)
+			}
+		case *ast.FuncLit:
+			fixFuncLabels(n.Body)
+		}
+		return true
+	})
+}
+
+// fixFuncLabels is like fixLabels for a single function body,
+// excluding any function literals within it.
+func fixFuncLabels(body *ast.BlockStmt) {
+	// inspect is like ast.Inspect, but stays within the function.
+	inspect := func(f func(ast.Node)) {
+		ast.Inspect(body, func(n ast.Node) bool {
+			if _, ok := n.(*ast.FuncLit); ok {
+				return false
+			}
+			f(n)
+			return true
+		})
+	}
+
+	defined := make(map[string]bool)
+	used := make(map[string]bool)
+	inspect(func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.LabeledStmt:
+			defined[n.Label.Name] = true
+		case *ast.BranchStmt:
+			if n.Label != nil {
+				used[n.Label.Name] = true
+			}
+		}
+	})
+
+	fix := func(list []ast.Stmt) []ast.Stmt {
+		var fixed []ast.Stmt
+		for _, stmt := range list {
+			switch s := stmt.(type) {
+			case *ast.BranchStmt:
+				if s.Label != nil && !defined[s.Label.Name] {
+					continue // dangling
+				}
+			case *ast.LabeledStmt:
+				if !used[s.Label.Name] {
+					stmt = s.Stmt
+				}
+			}
+			fixed = append(fixed, stmt)
+		}
+		return fixed
+	}
+	inspect(func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			n.List = fix(n.List)
+		case *ast.CaseClause:
+			n.Body = fix(n.Body)
+		case *ast.CommClause:
+			n.Body = fix(n.Body)
+		}
+	})
+}
+
+// HasCoverage reports whether any function in f was covered or is always
+// retained by Trim. If it returns false, trimming f would remove all of
+// its declarations, so the trimming can be skipped entirely.
+func (p *Profile) HasCoverage(f *ast.File) bool {
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && !p.excluded(fn) && (p.Funcs[fn] || p.alwaysKept(fn) || p.keptSignature(fn)) {
+			return true
+		}
+	}
+	if p.KeepMethodTypes {
+		recvTypes := p.packageUsage(p.ImportPaths[f]).methodTypes
+		for _, decl := range f.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+				for _, spec := range gen.Specs {
+					if recvTypes[spec.(*ast.TypeSpec).Name.Name] {
+						return true
+					}
+				}
+			}
+		}
+	}
+	if p.FieldUsage {
+		usage := p.packageUsage(p.ImportPaths[f]).fields
+		for _, decl := range f.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+				for _, spec := range gen.Specs {
+					if len(usage[spec.(*ast.TypeSpec)]) > 0 {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// coveredMethodTypes returns the names of the receiver types in the
+// package with the given import path that have at least one covered method,
+// not counting methods excluded by p.Exclude.
+func (p *Profile) coveredMethodTypes(importPath string) map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range p.Files {
+		if p.ImportPaths[f] != importPath {
+			continue
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && p.Funcs[fn] && !p.excluded(fn) {
+				if name := recvTypeName(fn); name != "" {
+					names[name] = true
+				}
+			}
+		}
+	}
+	return names
+}
+
+// recvTypeName returns the name of the receiver type of the method f,
+// or "" if f is not a method.
+func recvTypeName(f *ast.FuncDecl) string {
+	if f.Recv == nil || len(f.Recv.List) == 0 {
+		return ""
+	}
+	typ := f.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// FuncName returns the name of the function f, qualified by its
+// receiver type name if f is a method (e.g. "Profile.Trim").
+func FuncName(f *ast.FuncDecl) string {
+	if recv := recvTypeName(f); recv != "" {
+		return recv + "." + f.Name.Name
+	}
+	return f.Name.Name
+}
+
 // trimVisitor is an ast.Visitor that trims nodes as it walks the tree.
 type trimVisitor struct {
 	p *Profile
+
+	// methodTypes holds the receiver types whose methods are
+	// all kept, when p.KeepAllMethods is set.
+	methodTypes map[string]bool
+
+	// impls holds the implementations of interface methods called
+	// from covered functions, when type information is available.
+	impls map[*ast.FuncDecl]bool
+
+	// keep holds the names of functions to retain regardless
+	// of their coverage.
+	keep map[string]bool
+
+	// fieldUsage holds the struct types to retain along with their
+	// fields used by covered code, when p.FieldUsage is set.
+	fieldUsage map[*ast.TypeSpec][]string
+
+	// recvTypes holds the receiver types with covered methods whose
+	// declarations are retained, when p.KeepMethodTypes is set.
+	recvTypes map[string]bool
 }
 
 func (v *trimVisitor) Visit(node ast.Node) ast.Visitor {
@@ -28,12 +256,40 @@ func (v *trimVisitor) Visit(node ast.Node) ast.Visitor {
 		var replaced []ast.Decl
 		for _, decl := range node.Decls {
 			// Remove non-func declarations and funcs that were not covered
-			if f, ok := decl.(*ast.FuncDecl); ok && v.p.Funcs[f] {
+			f, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				if gen, ok := decl.(*ast.GenDecl); ok && v.keepTypes(gen) {
+					replaced = append(replaced, decl)
+				}
+				continue
+			}
+			if v.keepFunc(f) {
+				replaced = append(replaced, decl)
+			} else if v.p.keptSignature(f) {
+				f.Body = &ast.BlockStmt{Lbrace: f.Body.Lbrace, Rbrace: f.Body.Lbrace + 1}
 				replaced = append(replaced, decl)
 			}
 		}
 		node.Decls = replaced
 
+	case *ast.FuncDecl:
+		// Functions retained without having been covered are kept in
+		// full, as trimming would leave little of them.
+		if !v.p.Funcs[node] && v.forceKept(node) {
+			return nil
+		}
+
+	case *ast.FuncLit:
+		// Empty the bodies of function literals that were never called.
+		// Those that were are trimmed like any other block below. This
+		// includes the functions of go and defer statements, which are
+		// kept like any other simple statement once reached, even if a
+		// goroutine did not get to run before the profile was written.
+		if !v.visited(node.Body) {
+			node.Body = &ast.BlockStmt{Lbrace: node.Body.Lbrace, Rbrace: node.Body.Lbrace + 1}
+			return nil
+		}
+
 	// Node types containing lists of statements
 	case *ast.BlockStmt:
 		list = &node.List
@@ -54,6 +310,86 @@ func (v *trimVisitor) Visit(node ast.Node) ast.Visitor {
 	return v
 }
 
+// keepTypes filters the specs of gen to the type declarations that
+// should be retained, and reports whether any remain.
+func (v *trimVisitor) keepTypes(gen *ast.GenDecl) bool {
+	if gen.Tok != token.TYPE || (v.fieldUsage == nil && v.recvTypes == nil) {
+		return false
+	}
+	var specs []ast.Spec
+	for _, spec := range gen.Specs {
+		ts := spec.(*ast.TypeSpec)
+		if len(v.fieldUsage[ts]) > 0 || v.recvTypes[ts.Name.Name] {
+			specs = append(specs, spec)
+		}
+	}
+	gen.Specs = specs
+	return len(specs) > 0
+}
+
+// keepFunc reports whether the function declaration f should be retained.
+func (v *trimVisitor) keepFunc(f *ast.FuncDecl) bool {
+	if v.p.excluded(f) {
+		return false
+	}
+	if v.p.Funcs[f] || v.forceKept(f) {
+		return true
+	}
+	if v.impls[f] {
+		return true
+	}
+	if name := recvTypeName(f); name != "" && v.methodTypes[name] {
+		return true
+	}
+	return false
+}
+
+// forceKept reports whether f is retained regardless of its coverage,
+// either by p.alwaysKept or by being named in v.keep.
+func (v *trimVisitor) forceKept(f *ast.FuncDecl) bool {
+	return v.p.alwaysKept(f) || v.keep[f.Name.Name] || v.keep[FuncName(f)]
+}
+
+// alwaysKept reports whether f is retained regardless of its coverage.
+func (p *Profile) alwaysKept(f *ast.FuncDecl) bool {
+	if !p.TrimInit && f.Recv == nil && f.Name.Name == "init" {
+		return true
+	}
+	return hasKeepDirective(f)
+}
+
+// excluded reports whether f is removed regardless of its coverage,
+// as requested by p.Exclude.
+func (p *Profile) excluded(f *ast.FuncDecl) bool {
+	return p.Exclude != nil && p.Exclude(f)
+}
+
+// keptSignature reports whether the signature of f is retained when its
+// body is not, as requested by p.KeepExportedSignatures.
+func (p *Profile) keptSignature(f *ast.FuncDecl) bool {
+	if !p.KeepExportedSignatures || f.Body == nil || !f.Name.IsExported() || p.excluded(f) {
+		return false
+	}
+	if f.Recv != nil {
+		return ast.IsExported(recvTypeName(f))
+	}
+	return true
+}
+
+// hasKeepDirective reports whether the doc comment of f contains
+// the //discover:keep directive.
+func hasKeepDirective(f *ast.FuncDecl) bool {
+	if f.Doc == nil {
+		return false
+	}
+	for _, c := range f.Doc.List {
+		if strings.TrimSpace(c.Text) == keepDirective {
+			return true
+		}
+	}
+	return false
+}
+
 // replaceStmt returns the (possibly many) statements that should replace
 // stmt. Generally a stmt is untouched or removed, but in some cases a
 // single stmt can result in multiple statements. This is usually only the case
@@ -73,62 +409,73 @@ func (v *trimVisitor) replaceStmt(stmt ast.Stmt) []ast.Stmt {
 			return []ast.Stmt{stmt}
 		}
 
-		call := v.findCall(stmt.X)
-		if call != nil {
-			return []ast.Stmt{&ast.ExprStmt{call}}
+		// The range expression is evaluated even if the body is never
+		// entered. Keep it whole when it is a call or a channel receive,
+		// since its effects may depend on more than its first call.
+		// (Ranging over a plain channel variable cannot be told apart
+		// from ranging over a slice without type information.)
+		switch x := unparen(stmt.X).(type) {
+		case *ast.CallExpr:
+			return []ast.Stmt{&ast.ExprStmt{X: x}}
+		case *ast.UnaryExpr:
+			if x.Op == token.ARROW {
+				return []ast.Stmt{&ast.ExprStmt{X: x}}
+			}
 		}
-		return nil
+
+		return findCalls(stmt.X)
 
 	case *ast.ForStmt:
 		if v.visited(stmt.Body) {
 			return []ast.Stmt{stmt}
 		}
 
-		nodes := []*ast.CallExpr{
-			v.findCall(stmt.Init),
-			v.findCall(stmt.Cond),
-			v.findCall(stmt.Post),
-		}
-
-		var result []ast.Stmt
-		for _, call := range nodes {
-			if call != nil {
-				result = append(result, &ast.ExprStmt{call})
-			}
-		}
-		return result
+		return findCalls(stmt.Init, stmt.Cond, stmt.Post)
 
 	case *ast.IfStmt:
 		vIf := v.visited(stmt.Body)
 		vElse := v.visited(stmt.Else)
 
-		if !vIf {
-			var result []ast.Stmt
-			// If we didn't reach the body, pull out any calls from
-			// init and cond.
-			nodes := []*ast.CallExpr{
-				v.findCall(stmt.Init),
-				v.findCall(stmt.Cond),
-			}
-			for _, call := range nodes {
-				if call != nil {
-					result = append(result, &ast.ExprStmt{call})
-				}
+		if !vIf && vElse && v.p.GuardContext > 0 && v.untakenGuards(stmt) <= v.p.GuardContext {
+			// Keep the guard around the else branch that was taken,
+			// stubbing out the body that wasn't.
+			stmt.Body = &ast.BlockStmt{Lbrace: stmt.Body.Lbrace, Rbrace: stmt.Body.Lbrace + 1}
+			if elseIf, ok := stmt.Else.(*ast.IfStmt); ok {
+				stmt.Else = stmtBlock(elseIf, v.replaceStmt(elseIf))
 			}
+			return []ast.Stmt{stmt}
+		}
+
+		if !vIf && v.p.KeepErrorChecks && isErrorCheck(stmt) {
+			return []ast.Stmt{stmt}
+		}
 
+		if !vIf {
+			var elseList []ast.Stmt
 			if vElse {
 				// We reached the else; add it
 				if block, ok := stmt.Else.(*ast.BlockStmt); ok {
 					// For a block statement, add the statements individually
 					// so we don't end up with an unnecessary block
 					for _, stmt := range block.List {
-						result = append(result, v.replaceStmt(stmt)...)
+						elseList = append(elseList, v.replaceStmt(stmt)...)
 					}
 				} else {
-					result = append(result, v.replaceStmt(stmt.Else)...)
+					elseList = append(elseList, v.replaceStmt(stmt.Else)...)
 				}
 			}
-			return result
+
+			// If we didn't reach the body, pull out any calls from
+			// init and cond. Keep the init whole if the else branch
+			// uses the variables it declares.
+			var result []ast.Stmt
+			if assign := keptDecl(stmt.Init, elseList); assign != nil {
+				result = append(result, assign)
+			} else {
+				result = findCalls(stmt.Init)
+			}
+			result = append(result, findCalls(stmt.Cond)...)
+			return append(result, elseList...)
 		} else {
 			// We did take the if body
 			if !vElse {
@@ -139,6 +486,16 @@ func (v *trimVisitor) replaceStmt(stmt ast.Stmt) []ast.Stmt {
 			return []ast.Stmt{stmt}
 		}
 
+	case *ast.LabeledStmt:
+		// Trim the labeled statement itself, keeping the label only if
+		// the statement is kept. Any break or continue referring to the
+		// label is within the statement, so it goes away along with it.
+		replaced := v.replaceStmt(stmt.Stmt)
+		if len(replaced) > 0 && replaced[0] == stmt.Stmt {
+			return append([]ast.Stmt{stmt}, replaced[1:]...)
+		}
+		return replaced
+
 	case *ast.SelectStmt:
 		var list []ast.Stmt
 		for _, stmt := range stmt.Body.List {
@@ -146,14 +503,28 @@ func (v *trimVisitor) replaceStmt(stmt ast.Stmt) []ast.Stmt {
 				list = append(list, stmt)
 			}
 		}
+
+		// If no clause was taken, drop the select altogether but keep
+		// the calls evaluated by the channel operations on entering it.
+		if len(list) == 0 {
+			var result []ast.Stmt
+			for _, clause := range stmt.Body.List {
+				result = append(result, findCalls(clause.(*ast.CommClause).Comm)...)
+			}
+			return result
+		}
 		stmt.Body.List = list
 		return []ast.Stmt{stmt}
 
 	case *ast.SwitchStmt:
 		var list []ast.Stmt
+		fallsThrough := false
 		for _, stmt := range stmt.Body.List {
-			if v.visitedAndMatters(stmt) {
+			// A clause reached through a fallthrough in a kept clause
+			// must be kept for the fallthrough to remain valid.
+			if fallsThrough || v.visitedAndMatters(stmt) {
 				list = append(list, stmt)
+				fallsThrough = endsInFallthrough(stmt.(*ast.CaseClause))
 			}
 		}
 
@@ -183,6 +554,72 @@ func (v *trimVisitor) replaceStmt(stmt ast.Stmt) []ast.Stmt {
 	}
 }
 
+// untakenGuards returns the number of consecutive if statements in the
+// else-if chain starting at stmt whose bodies were not taken.
+func (v *trimVisitor) untakenGuards(stmt *ast.IfStmt) int {
+	n := 0
+	for stmt != nil && !v.visited(stmt.Body) {
+		n++
+		stmt, _ = stmt.Else.(*ast.IfStmt)
+	}
+	return n
+}
+
+// endsInFallthrough reports whether the body of clause ends in
+// a fallthrough statement.
+func endsInFallthrough(clause *ast.CaseClause) bool {
+	if n := len(clause.Body); n > 0 {
+		branch, ok := clause.Body[n-1].(*ast.BranchStmt)
+		return ok && branch.Tok == token.FALLTHROUGH
+	}
+	return false
+}
+
+// keptDecl returns the short variable declaration stmt, with the variables
+// not referred to by any of the statements in list replaced by the blank
+// identifier, or nil if none of the declared variables are referred to.
+func keptDecl(stmt ast.Stmt, list []ast.Stmt) *ast.AssignStmt {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || assign.Tok != token.DEFINE {
+		return nil
+	}
+	used := make(map[*ast.Object]bool)
+	for _, s := range list {
+		ast.Inspect(s, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Obj != nil {
+				used[id.Obj] = true
+			}
+			return true
+		})
+	}
+
+	kept := *assign
+	kept.Lhs = make([]ast.Expr, len(assign.Lhs))
+	anyUsed := false
+	for i, lhs := range assign.Lhs {
+		if id, ok := lhs.(*ast.Ident); ok && !used[id.Obj] {
+			lhs = &ast.Ident{NamePos: id.NamePos, Name: "_"}
+		} else {
+			anyUsed = true
+		}
+		kept.Lhs[i] = lhs
+	}
+	if !anyUsed {
+		return nil
+	}
+	return &kept
+}
+
+// stmtBlock returns the statement to use in place of orig when it was
+// replaced by list: orig itself if it was kept as-is, or a block holding
+// the replacement statements.
+func stmtBlock(orig ast.Stmt, list []ast.Stmt) ast.Stmt {
+	if len(list) == 1 && list[0] == orig {
+		return orig
+	}
+	return &ast.BlockStmt{Lbrace: orig.Pos(), List: list, Rbrace: orig.End() - 1}
+}
+
 // visited is a helper function to return whether or not a statement
 // was visited. If stmt is nil, visited returns false.
 func (v *trimVisitor) visited(stmt ast.Stmt) bool {
@@ -229,25 +666,79 @@ func (v *trimVisitor) visitedAndMatters(stmt ast.Stmt) bool {
 	}
 }
 
-// findCall returns the first *ast.CallExpr encountered within the tree
-// rooted at node, or nil if no CallExpr was found. This is useful for
-// "pulling out" calls out of a statement or expression.
-func (v *trimVisitor) findCall(node ast.Node) *ast.CallExpr {
-	if node == nil { // for convenience
-		return nil
+// findCalls returns statements for the outermost calls within the trees
+// rooted at nodes, in source order. This is useful for "pulling out" calls
+// out of a statement or expression, such as both calls of "f() && g()".
+// Calls nested within another call, such as the calls of a chain like
+// "a().b()" or of the arguments of a call, are evaluated as part of it and
+// are not returned separately. Neither are calls within function literals
+// that are not called. Nil nodes are ignored.
+func findCalls(nodes ...ast.Node) []ast.Stmt {
+	var calls []ast.Stmt
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				calls = append(calls, &ast.ExprStmt{X: n})
+				return false
+			case *ast.FuncLit:
+				return false
+			}
+			return true
+		})
 	}
+	return calls
+}
 
-	var call *ast.CallExpr
-	ast.Inspect(node, func(n ast.Node) bool {
-		if call != nil {
+// isErrorCheck reports whether stmt is an error check of the form
+// "if x != nil { ...; return ... }" (or ending in a call of panic),
+// optionally with an init statement and without an else branch.
+func isErrorCheck(stmt *ast.IfStmt) bool {
+	if stmt.Else != nil || len(stmt.Body.List) == 0 {
+		return false
+	}
+	cond, ok := unparen(stmt.Cond).(*ast.BinaryExpr)
+	if !ok || cond.Op != token.NEQ {
+		return false
+	}
+	x, y := unparen(cond.X), unparen(cond.Y)
+	if isNil(x) {
+		x, y = y, x
+	}
+	if _, ok := x.(*ast.Ident); !ok || !isNil(y) {
+		return false
+	}
+
+	switch last := stmt.Body.List[len(stmt.Body.List)-1].(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.ExprStmt:
+		call, ok := last.X.(*ast.CallExpr)
+		if !ok {
 			return false
 		}
-		c, ok := n.(*ast.CallExpr)
-		if ok {
-			call = c
-			return false
+		id, ok := call.Fun.(*ast.Ident)
+		return ok && id.Name == "panic"
+	}
+	return false
+}
+
+// isNil reports whether e is the identifier nil.
+func isNil(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == "nil"
+}
+
+// unparen returns e with any enclosing parentheses stripped.
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
 		}
-		return true
-	})
-	return call
+		e = p.X
+	}
 }
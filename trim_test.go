@@ -0,0 +1,634 @@
+package discover
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestTrimKeepDirective(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	checkFunc(t, p, f, "Debug", `
+// Debug is not called by the tests, but is always kept.
+//
+//discover:keep
+func Debug() string {
+	return "debug"
+}`)
+	checkFunc(t, p, f, "unused", "")
+
+	// Uncovered functions are kept in full, not just their skeleton.
+	checkFunc(t, p, f, "Reset", `
+// Reset is not called by the tests, but is always kept in full.
+//
+//discover:keep
+func Reset(xs []int) {
+	for i := range xs {
+		if xs[i] > 0 {
+			xs[i] = 0
+		}
+	}
+}`)
+}
+
+func TestTrimRange(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// Ranging over a plain channel variable cannot be told apart from
+	// ranging over a slice, so the loop is dropped entirely. Calls and
+	// channel receives are kept for their effects.
+	checkFunc(t, p, f, "Ranges", `
+// Ranges ranges over channels and values that the tests leave empty.
+func Ranges(ch chan int, chans chan chan int) int {
+	n := 0
+
+	values()
+
+	<-chans
+
+	for _, v := range []int{1} {
+		n += v
+	}
+	return n
+}`)
+}
+
+func TestTrimSelect(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// The empty default clause ran.
+	checkFunc(t, p, f, "Select", `
+// Select receives from c if a value is ready.
+func Select(c chan int) int {
+	select {
+
+	default:
+	}
+	return 0
+}`)
+
+	// No clause ran, so only the calls evaluated on entering the select
+	// remain.
+	checkFunc(t, p, f, "SelectWait", `
+// SelectWait signals started and then waits on channels that are
+// never ready.
+func SelectWait(started chan<- bool, c chan int) int {
+	started <- true
+
+	recv(c)
+
+	value()
+
+}`)
+}
+
+func BenchmarkHasCoverage(b *testing.B) {
+	p, err := ParseProfile([]*cover.Profile{syntheticProfile(b, 1000, 0)})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// Skipping an uncovered file should be much cheaper than trimming it.
+	b.Run("Trim", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			c := p.Clone()
+			b.StartTimer()
+			c.Trim(c.Files[0])
+		}
+	})
+	b.Run("HasCoverage", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if p.HasCoverage(p.Files[0]) {
+				b.Fatal("uncovered file has coverage")
+			}
+		}
+	})
+}
+
+func TestTrimLabels(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// The label of the loop that was never entered goes away with it.
+	// The labels whose continue statements were trimmed are dropped,
+	// while the one still referred to by a break is kept.
+	checkFunc(t, p, f, "Labels", `
+// Labels sums the positive elements of the rows of xs, up to the first
+// zero.
+func Labels(xs [][]int) int {
+	n := 0
+rows:
+	for _, row := range xs {
+
+		for _, x := range row {
+			switch {
+
+			case x == 0:
+				break rows
+
+			}
+			n += x
+		}
+	}
+
+	return n
+}`)
+}
+
+func TestTrimOutputParses(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// The statements built by trimming, such as those for the calls
+	// pulled out of trimmed statements, must be complete.
+	ast.Inspect(f, func(n ast.Node) bool {
+		if s, ok := n.(*ast.ExprStmt); ok && s.X == nil {
+			t.Errorf("expression statement at %v has no expression", p.Fset.Position(s.Pos()))
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	if err := p.WriteFile(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", buf.Bytes(), 0); err != nil {
+		t.Errorf("trimmed file does not parse: %v\n%s", err, buf.Bytes())
+	}
+}
+
+func TestTrimFallthrough(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// The empty case 2 has no effect of its own, but must be kept for
+	// the fallthrough of case 1 to remain valid.
+	checkFunc(t, p, f, "Fall", `
+// Fall describes x, falling through from one case to the next.
+func Fall(x int) string {
+	s := ""
+	switch x {
+	case 1:
+		s = "one"
+		fallthrough
+	case 2:
+
+	}
+	return s
+}`)
+}
+
+func TestTrimInit(t *testing.T) {
+	const want = `
+func init() {
+	registry = make(map[string]int)
+}`
+	tests := []struct {
+		name     string
+		trimInit bool
+		exclude  string
+		want     string
+	}{
+		{"default", false, "", want},
+		{"TrimInit", true, "", ""},
+		{"Exclude", false, "init", ""},
+		{"ExcludeOther", false, "Debug", want},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadTestdata(t, "trim")
+			f := testFile(t, p, "trim.go")
+			// Init functions always run, so pretend this one did not
+			// get covered by the tests.
+			delete(p.Funcs, funcDecl(f, "init"))
+			p.TrimInit = tt.trimInit
+			if tt.exclude != "" {
+				p.Exclude = func(fn *ast.FuncDecl) bool { return fn.Name.Name == tt.exclude }
+			}
+			p.Trim(f)
+			checkFunc(t, p, f, "init", tt.want)
+		})
+	}
+}
+
+func TestTrimExclude(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Exclude = func(fn *ast.FuncDecl) bool { return fn.Name.Name == "Covered" || fn.Name.Name == "Debug" }
+	p.TrimWithKeep(f, map[string]bool{"Debug": true})
+
+	// Exclusion takes precedence over coverage, the //discover:keep
+	// directive and the keep set alike.
+	for _, name := range []string{"Covered", "Debug"} {
+		if funcDecl(f, name) != nil {
+			t.Errorf("excluded function %s was kept", name)
+		}
+	}
+	if funcDecl(f, "helper") == nil {
+		t.Error("covered function helper was trimmed")
+	}
+}
+
+func TestTrimKeepExportedSignatures(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		p := loadTestdata(t, "trim")
+		f := testFile(t, p, "trim.go")
+		p.KeepExportedSignatures = keep
+		p.Trim(f)
+
+		exported := map[string]string{
+			"Exported": `
+// Exported is not called by the tests.
+func Exported(x int) int {}`,
+			"Counter.Dec": `
+// Dec is not called by the tests.
+func (c *Counter) Dec() {}`,
+		}
+		for name, want := range exported {
+			if !keep {
+				want = ""
+			}
+			checkFunc(t, p, f, name, want)
+		}
+
+		// Unexported functions, and methods of unexported types,
+		// are trimmed either way.
+		for _, name := range []string{"unexported", "Counter.reset", "counter.Get"} {
+			checkFunc(t, p, f, name, "")
+		}
+		checkFunc(t, p, f, "Counter.Inc", `
+// Inc is called by the tests.
+func (c *Counter) Inc() {
+	c.n++
+}`)
+	}
+}
+
+func TestTrimWithKeep(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.TrimWithKeep(f, map[string]bool{
+		"unused":      true, // function
+		"Counter.Dec": true, // qualified method
+		"reset":       true, // unqualified method
+		"Exported":    true,
+	})
+
+	// Like those with the //discover:keep directive, the uncovered
+	// functions are kept in full.
+	checkFunc(t, p, f, "Exported", `
+// Exported is not called by the tests.
+func Exported(x int) int {
+	if x < 0 {
+		x = -x
+	}
+	return x * 2
+}`)
+
+	for _, name := range []string{"Covered", "unused", "Counter.Inc", "Counter.Dec", "Counter.reset"} {
+		if funcDecl(f, name) == nil {
+			t.Errorf("%s was trimmed", name)
+		}
+	}
+	for _, name := range []string{"unexported", "counter.Get"} {
+		if funcDecl(f, name) != nil {
+			t.Errorf("%s was kept", name)
+		}
+	}
+}
+
+func TestTrimFuncLit(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// The body of the closure that was never called is emptied, while
+	// the one that was is trimmed like any other function body.
+	checkFunc(t, p, f, "Closures", `
+// Closures returns a closure, leaving another one uncalled.
+func Closures(x int) func() int {
+	double := func() int {}
+
+	_ = double
+	return func() int {
+
+		return x
+	}
+}`)
+}
+
+func TestTrimGoDefer(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// The launched and deferred closures are kept, and trimmed on their
+	// own coverage.
+	checkFunc(t, p, f, "Launch", `
+// Launch makes x positive on a goroutine.
+func Launch(x int) int {
+	done := make(chan int)
+	defer func() {
+		recover()
+
+	}()
+	go func() {
+
+		done <- x
+	}()
+	return <-done
+}`)
+}
+
+func TestTrimBranchToRemovedLabel(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// The goto is reached, but the statement it jumps to is trimmed,
+	// taking the label with it. The goto must go as well,
+	// leaving the if that guarded it empty.
+	checkFunc(t, p, f, "Clamp", `
+// Clamp limits x to 10, unless it is negative.
+func Clamp(x int) int {
+	if x < 0 {
+
+	}
+
+	return x
+}`)
+
+	// The labeled loop is kept, along with its label for the break that
+	// was taken, while the continue is trimmed.
+	checkFunc(t, p, f, "Find", `
+// Find returns the index of y in xs, or -1.
+func Find(xs []int, y int) int {
+	i := -1
+search:
+	for j, x := range xs {
+
+		if x == y {
+			i = j
+			break search
+		}
+	}
+	return i
+}`)
+}
+
+func TestTrimCollapse(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Significant = p.IsSignificant
+	p.Trim(f)
+
+	// Straight-line code is collapsed, but the clauses of switch and
+	// select statements are not, even though they are not significant
+	// in themselves.
+	checkFunc(t, p, f, "Sign", `
+// Sign describes the sign of x.
+func Sign(x int) string {
+	// ... 2 statements
+
+	switch {
+	case x > 0:
+		s += " positive"
+
+	default:
+		s += " zero"
+	}
+	return s
+}`)
+	checkFunc(t, p, f, "Select", `
+// Select receives from c if a value is ready.
+func Select(c chan int) int {
+	select {
+
+	default:
+	}
+	return 0
+}`)
+}
+
+func TestTrimKeepMethodTypes(t *testing.T) {
+	tests := []struct {
+		name           string
+		keepTypes      bool
+		keepAll        bool
+		wantTypes      []string
+		wantMethods    []string
+		trimmedMethods []string
+	}{
+		{"default", false, false, nil, []string{"Counter.Inc"}, []string{"Counter.Dec", "Counter.reset", "counter.Get"}},
+		{"KeepMethodTypes", true, false, []string{"Counter"}, []string{"Counter.Inc"}, []string{"Counter.Dec", "Counter.reset", "counter.Get"}},
+		{"KeepAllMethods", true, true, []string{"Counter"}, []string{"Counter.Inc", "Counter.Dec", "Counter.reset"}, []string{"counter.Get"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadTestdata(t, "trim")
+			f := testFile(t, p, "trim.go")
+			p.KeepMethodTypes = tt.keepTypes
+			p.KeepAllMethods = tt.keepAll
+			p.Trim(f)
+
+			// Only the type with covered methods is kept, not the type
+			// whose methods were all left uncalled.
+			var types []string
+			for _, decl := range f.Decls {
+				if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+					for _, spec := range gen.Specs {
+						types = append(types, spec.(*ast.TypeSpec).Name.Name)
+					}
+				}
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Errorf("types = %v, want %v", types, tt.wantTypes)
+			}
+			for _, name := range tt.wantMethods {
+				if funcDecl(f, name) == nil {
+					t.Errorf("%s was trimmed", name)
+				}
+			}
+			for _, name := range tt.trimmedMethods {
+				if funcDecl(f, name) != nil {
+					t.Errorf("%s was kept", name)
+				}
+			}
+		})
+	}
+}
+
+func TestFindCalls(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"a().b().c()", []string{"a().b().c()"}},
+		{"f(g(), h())", []string{"f(g(), h())"}},
+		{"f() && g()", []string{"f()", "g()"}},
+		{"f() || !g(x)", []string{"f()", "g(x)"}},
+		{"(f())", []string{"f()"}},
+		{"x + y", nil},
+		{"func() { x() }", nil},
+		{"func() { x() }()", []string{"func() {\n\tx()\n}()"}},
+		{"h(func() { x() })", []string{"h(func() {\n\tx()\n})"}},
+	}
+	for _, tt := range tests {
+		x, err := parser.ParseExpr(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, stmt := range findCalls(x) {
+			var buf bytes.Buffer
+			if err := format.Node(&buf, token.NewFileSet(), stmt); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, buf.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findCalls(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+	if got := findCalls(nil, nil); len(got) != 0 {
+		t.Errorf("findCalls(nil, nil) = %v, want none", got)
+	}
+}
+
+func TestTrimIfInit(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	p.Trim(f)
+
+	// The variables of the init statement used by the else branch are
+	// still declared, while the others are blanked out.
+	checkFunc(t, p, f, "Double", `
+// Double doubles the number in s, or returns 0 if it is invalid.
+func Double(s string) int {
+	n, _ := strconv.Atoi(s)
+
+	return helper(n) * 2
+
+}`)
+
+	// With none of them used, only the call remains.
+	checkFunc(t, p, f, "Valid", `
+// Valid reports whether s is a valid number.
+func Valid(s string) bool {
+	ok := false
+	strconv.Atoi(s)
+
+	ok = true
+
+	return ok
+}`)
+}
+
+func TestTrimGuardContext(t *testing.T) {
+	// The else branch was taken after two untaken guards. The guards
+	// nearest to it are kept, up to the given number.
+	tests := []string{`
+// Grade grades a score.
+func Grade(score int) string {
+
+	return "F"
+
+}`, `
+// Grade grades a score.
+func Grade(score int) string {
+
+	if score >= 80 {
+	} else {
+		return "F"
+	}
+}`, `
+// Grade grades a score.
+func Grade(score int) string {
+	if score >= 90 {
+	} else if score >= 80 {
+	} else {
+		return "F"
+	}
+}`}
+	for n, want := range tests {
+		p := loadTestdata(t, "trim")
+		f := testFile(t, p, "trim.go")
+		p.GuardContext = n
+		p.Trim(f)
+		checkFunc(t, p, f, "Grade", want)
+	}
+}
+
+func TestTrimKeepErrorChecks(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		p := loadTestdata(t, "trim")
+		f := testFile(t, p, "trim.go")
+		p.KeepErrorChecks = keep
+		p.Trim(f)
+
+		want := `
+// Load parses s, failing on invalid numbers.
+func Load(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+
+	return n, nil
+}`
+		if keep {
+			want = `
+// Load parses s, failing on invalid numbers.
+func Load(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}`
+		}
+		checkFunc(t, p, f, "Load", want)
+	}
+}
+
+func TestIsErrorCheck(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want bool
+	}{
+		{"if err != nil { return err }", true},
+		{"if nil != err { log(err); return }", true},
+		{"if (err != nil) { panic(err) }", true},
+		{"if err := f(); err != nil { return err }", true},
+		{"if err != nil { return err } else { x++ }", false},
+		{"if err == nil { return err }", false},
+		{"if err != nil { log(err) }", false},
+		{"if err != nil {}", false},
+		{"if err != io.EOF { return err }", false},
+		{"if f() != nil { return nil }", false},
+	}
+	for _, tt := range tests {
+		f, err := parser.ParseFile(token.NewFileSet(), "", "package p; func f() {"+tt.stmt+"}", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmt := f.Decls[0].(*ast.FuncDecl).Body.List[0].(*ast.IfStmt)
+		if got := isErrorCheck(stmt); got != tt.want {
+			t.Errorf("isErrorCheck(%q) = %v, want %v", tt.stmt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package discover
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/cover"
+	"golang.org/x/tools/go/loader"
+)
+
+// ParseProfileTyped is like ParseProfileOptions, but also type-checks the
+// packages of the profiled files and records the result in the TypesInfo
+// field of the Profile. This is considerably slower, since the packages
+// and their dependencies are loaded from source using go/loader.
+//
+// With type information, Trim resolves calls of interface methods within
+// covered functions to the methods implementing them, and retains those
+// implementations even if they were not covered themselves.
+func ParseProfileTyped(profs []*cover.Profile, opts *Options) (*Profile, error) {
+	p, err := ParseProfileOptions(profs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Type-check the files already parsed for the profile, so that
+	// the type information refers to the nodes of p.Files. Files of
+	// external test packages make up packages of their own.
+	type pkgKey struct{ path, name string }
+	var keys []pkgKey
+	files := make(map[pkgKey][]*ast.File)
+	for _, f := range p.Files {
+		k := pkgKey{p.ImportPaths[f], f.Name.Name}
+		if strings.HasSuffix(k.name, "_test") {
+			k.path += "_test"
+		}
+		if _, ok := files[k]; !ok {
+			keys = append(keys, k)
+		}
+		files[k] = append(files[k], f)
+	}
+
+	conf := &loader.Config{
+		Fset:       p.Fset,
+		Build:      p.opts.Context,
+		ParserMode: parser.ParseComments,
+		// Report the packages that could be type-checked, even if
+		// others (such as those using cgo) could not.
+		AllowErrors: true,
+	}
+	conf.TypeChecker.Error = func(error) {}
+	for _, k := range keys {
+		conf.CreateFromFiles(k.path, files[k]...)
+	}
+	prog, err := conf.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	p.TypesInfo = &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	for _, info := range prog.Created {
+		for k, v := range info.Types {
+			p.TypesInfo.Types[k] = v
+		}
+		for k, v := range info.Defs {
+			p.TypesInfo.Defs[k] = v
+		}
+		for k, v := range info.Uses {
+			p.TypesInfo.Uses[k] = v
+		}
+		for k, v := range info.Selections {
+			p.TypesInfo.Selections[k] = v
+		}
+	}
+	return p, nil
+}
+
+// interfaceImpls returns the methods in p.Files implementing an interface
+// method called from a covered function, as resolved by p.TypesInfo.
+func (p *Profile) interfaceImpls() map[*ast.FuncDecl]bool {
+	type ifaceMethod struct {
+		iface *types.Interface
+		name  string
+	}
+	var called []ifaceMethod
+	for _, fn := range p.coveredFuncs() {
+		ast.Inspect(fn, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			s := p.TypesInfo.Selections[sel]
+			if s == nil || s.Kind() != types.MethodVal {
+				return true
+			}
+			if iface, ok := s.Recv().Underlying().(*types.Interface); ok {
+				called = append(called, ifaceMethod{iface, s.Obj().Name()})
+			}
+			return true
+		})
+	}
+
+	impls := make(map[*ast.FuncDecl]bool)
+	if len(called) == 0 {
+		return impls
+	}
+	for _, f := range p.Files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil {
+				continue
+			}
+			obj, ok := p.TypesInfo.Defs[fn.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			recv := obj.Type().(*types.Signature).Recv().Type()
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+			}
+			for _, m := range called {
+				if m.name == fn.Name.Name && (types.Implements(recv, m.iface) || types.Implements(types.NewPointer(recv), m.iface)) {
+					impls[fn] = true
+					break
+				}
+			}
+		}
+	}
+	return impls
+}
@@ -0,0 +1,47 @@
+package discover
+
+import (
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestParseProfileTyped(t *testing.T) {
+	profs, err := cover.ParseProfiles(filepath.Join("testdata", "typed", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParseProfileTyped(profs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TypesInfo == nil || len(p.TypesInfo.Selections) == 0 {
+		t.Fatal("no type information")
+	}
+	f := testFile(t, p, "typed.go")
+	if p.Funcs[funcDecl(f, "Circle.Area")] {
+		t.Fatal("Circle.Area is covered")
+	}
+	p.Trim(f)
+
+	// Circle.Area implements the interface method called by Total, so
+	// it is kept, although it was not covered.
+	checkFunc(t, p, f, "Circle.Area", `
+// Area is not called, but implements Shape.
+func (c *Circle) Area() int {
+	return 3 * c.r * c.r
+}`)
+	checkFunc(t, p, f, "Circle.Radius", "")
+	checkFunc(t, p, f, "Square.Area", `
+// Area is called through Shape.
+func (s Square) Area() int {
+	return s.side * s.side
+}`)
+
+	// Without type information, it is not.
+	p = loadTestdata(t, "typed")
+	f = testFile(t, p, "typed.go")
+	p.Trim(f)
+	checkFunc(t, p, f, "Circle.Area", "")
+}
@@ -0,0 +1,107 @@
+package discover
+
+import "go/ast"
+
+// Walk traverses the AST of f in depth-first order like ast.Inspect, but
+// only visits the parts of the program that were reached according to the
+// coverage profile: covered function declarations, and within them only
+// the branches that were taken, skipping the same bodies, else branches,
+// clauses and function literal bodies that Trim would remove. Other
+// declarations are skipped.
+//
+// Unlike Trim, Walk does not modify the AST. If visit returns false for
+// a node, the children of that node are not visited.
+func (p *Profile) Walk(f *ast.File, visit func(ast.Node) bool) {
+	ast.Walk(&walkVisitor{p: p, visit: visit}, f)
+}
+
+// walkVisitor is an ast.Visitor that skips unreached nodes.
+type walkVisitor struct {
+	p     *Profile
+	visit func(ast.Node) bool
+}
+
+func (w *walkVisitor) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case nil:
+		return nil
+
+	case *ast.File:
+		if !w.visit(n) {
+			return nil
+		}
+		for _, decl := range n.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && w.p.Funcs[fn] {
+				ast.Walk(w, fn)
+			}
+		}
+		return nil
+
+	case *ast.CaseClause, *ast.CommClause:
+		if !w.reached(n.(ast.Stmt)) {
+			return nil
+		}
+
+	case *ast.IfStmt:
+		if !w.visit(n) {
+			return nil
+		}
+		w.walk(n.Init, n.Cond)
+		if w.reached(n.Body) {
+			w.walk(n.Body)
+		}
+		if w.reached(n.Else) {
+			w.walk(n.Else)
+		}
+		return nil
+
+	case *ast.ForStmt:
+		if !w.visit(n) {
+			return nil
+		}
+		w.walk(n.Init, n.Cond, n.Post)
+		if w.reached(n.Body) {
+			w.walk(n.Body)
+		}
+		return nil
+
+	case *ast.FuncLit:
+		if !w.visit(n) {
+			return nil
+		}
+		w.walk(n.Type)
+		if w.reached(n.Body) {
+			w.walk(n.Body)
+		}
+		return nil
+
+	case *ast.RangeStmt:
+		if !w.visit(n) {
+			return nil
+		}
+		w.walk(n.Key, n.Value, n.X)
+		if w.reached(n.Body) {
+			w.walk(n.Body)
+		}
+		return nil
+	}
+
+	if !w.visit(node) {
+		return nil
+	}
+	return w
+}
+
+// walk walks each of the non-nil nodes.
+func (w *walkVisitor) walk(nodes ...ast.Node) {
+	for _, n := range nodes {
+		if n != nil {
+			ast.Walk(w, n)
+		}
+	}
+}
+
+// reached reports whether stmt was reached according to the profile.
+func (w *walkVisitor) reached(stmt ast.Stmt) bool {
+	return stmt != nil && w.p.Stmts[stmt]
+}
@@ -0,0 +1,84 @@
+package discover
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	p := loadTestdata(t, "trim")
+	f := testFile(t, p, "trim.go")
+	var before bytes.Buffer
+	if err := p.WriteFile(&before, f); err != nil {
+		t.Fatal(err)
+	}
+
+	// walk returns the functions visited, and the string literals visited
+	// within the function with the given name.
+	walk := func(name string, visit func(ast.Node) bool) (funcs map[string]bool, strs []string) {
+		funcs = make(map[string]bool)
+		var cur string
+		p.Walk(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				cur = FuncName(n)
+				funcs[cur] = true
+			case *ast.BasicLit:
+				if n.Kind == token.STRING && cur == name {
+					s, _ := strconv.Unquote(n.Value)
+					strs = append(strs, s)
+				}
+			}
+			return visit(n)
+		})
+		return funcs, strs
+	}
+
+	funcs, strs := walk("Sign", func(ast.Node) bool { return true })
+	for name, want := range map[string]bool{"Covered": true, "Sign": true, "Debug": false, "Exported": false, "unused": false} {
+		if funcs[name] != want {
+			t.Errorf("%s visited = %v, want %v", name, funcs[name], want)
+		}
+	}
+	// The case that was not taken is skipped.
+	if want := []string{"x", " is", " positive", " zero"}; !reflect.DeepEqual(strs, want) {
+		t.Errorf("strings visited in Sign = %q, want %q", strs, want)
+	}
+
+	// Returning false skips the children of a node.
+	_, strs = walk("Sign", func(n ast.Node) bool {
+		_, isSwitch := n.(*ast.SwitchStmt)
+		return !isSwitch
+	})
+	if want := []string{"x", " is"}; !reflect.DeepEqual(strs, want) {
+		t.Errorf("strings visited in Sign outside the switch = %q, want %q", strs, want)
+	}
+
+	// The body of the closure that was never called is skipped as well,
+	// as is the untaken if statement in the other.
+	var returns int
+	p.Walk(f, func(n ast.Node) bool {
+		if fn, ok := n.(*ast.FuncDecl); ok {
+			return fn.Name.Name == "Closures"
+		}
+		if _, ok := n.(*ast.ReturnStmt); ok {
+			returns++
+		}
+		return true
+	})
+	if returns != 2 {
+		t.Errorf("visited %d return statements in Closures, want 2", returns)
+	}
+
+	var after bytes.Buffer
+	if err := p.WriteFile(&after, f); err != nil {
+		t.Fatal(err)
+	}
+	if after.String() != before.String() {
+		t.Error("Walk modified the file")
+	}
+}
@@ -0,0 +1,84 @@
+package discover
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io"
+	"io/ioutil"
+)
+
+// WriteFile writes the source of f, typically after trimming it,
+// to w using gofmt formatting, or p.Printer if it is set.
+func (p *Profile) WriteFile(w io.Writer, f *ast.File) error {
+	fset := p.Fset
+	if p.KeepSpacing {
+		fset = p.compactFileSet(f)
+	}
+	if p.Printer != nil {
+		return p.Printer.Fprint(w, fset, f)
+	}
+	return format.Node(w, fset, f)
+}
+
+// compactFileSet returns a FileSet for printing f in which the lines of
+// the original source that no longer hold any code or comments are merged
+// into the preceding line. This way the printer only sees the blank lines
+// that were present in the original source. If the original source cannot
+// be read, p.Fset is returned.
+func (p *Profile) compactFileSet(f *ast.File) *token.FileSet {
+	tf := p.Fset.File(f.Pos())
+	if tf == nil {
+		return p.Fset
+	}
+	src, err := ioutil.ReadFile(tf.Name())
+	if err != nil || len(src) != tf.Size() {
+		return p.Fset
+	}
+
+	// Mark the lines that still hold code or comments
+	used := make([]bool, tf.LineCount()+2)
+	mark := func(from, to token.Pos) {
+		if !from.IsValid() || !to.IsValid() || int(from) < tf.Base() || int(to) > tf.Base()+tf.Size() {
+			return
+		}
+		for line := rawLine(tf, from); line <= rawLine(tf, to); line++ {
+			used[line] = true
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil:
+			return false
+		case *ast.BasicLit:
+			mark(n.Pos(), n.End()) // may be a multi-line raw string
+		default:
+			mark(n.Pos(), n.Pos())
+			mark(n.End()-1, n.End()-1)
+		}
+		return true
+	})
+	for _, cg := range f.Comments {
+		mark(cg.Pos(), cg.End())
+	}
+
+	// Drop the line starts of unused, non-blank lines
+	var lines []int
+	for line := 1; line <= tf.LineCount(); line++ {
+		start := tf.Offset(tf.LineStart(line))
+		end := len(src)
+		if line < tf.LineCount() {
+			end = tf.Offset(tf.LineStart(line + 1))
+		}
+		if line == 1 || used[line] || len(bytes.TrimSpace(src[start:end])) == 0 {
+			lines = append(lines, start)
+		}
+	}
+
+	fset := token.NewFileSet()
+	if !fset.AddFile(tf.Name(), tf.Base(), tf.Size()).SetLines(lines) {
+		return p.Fset
+	}
+	return fset
+}
@@ -0,0 +1,35 @@
+package discover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileKeepSpacing(t *testing.T) {
+	// By default, a blank line is left where the if statement was
+	// trimmed. With KeepSpacing, only the blank lines of the original
+	// source remain.
+	tests := map[bool]string{
+		false: "func Spaced(x int) int {\n\ty := x + 1\n\n\tz := y * 2\n\n\treturn z\n}\n",
+		true:  "func Spaced(x int) int {\n\ty := x + 1\n\tz := y * 2\n\n\treturn z\n}\n",
+	}
+	for keep, want := range tests {
+		p := loadTestdata(t, "trim")
+		f := testFile(t, p, "trim.go")
+		p.KeepSpacing = keep
+		p.Trim(f)
+		var buf bytes.Buffer
+		if err := p.WriteFile(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+		src := buf.String()
+		i := strings.Index(src, "func Spaced")
+		if i < 0 {
+			t.Fatalf("no Spaced in output:\n%s", src)
+		}
+		if got := src[i : i+strings.Index(src[i:], "\n}\n")+3]; got != want {
+			t.Errorf("KeepSpacing=%v: got:\n%s\nwant:\n%s", keep, got, want)
+		}
+	}
+}